@@ -0,0 +1,41 @@
+package subtocheck
+
+import (
+	"strings"
+)
+
+// issueKey identifies an issue between runs. Issues with the same key but, for example, a different CNAME chain
+// or severity are treated as changed.
+func issueKey(issue Issue) string {
+	return strings.Join([]string{issue.Kind, issue.FQDN, issue.URL, issue.Platform, issue.MXHost,
+		strings.Join(issue.CNAMEChain, ","), issue.Severity}, "|")
+}
+
+// exclude returns the results with the issues that are also in the baseline, including those unchanged in it,
+// moved to Unchanged. Suppressed issues in the baseline are ignored so that they're reported once their
+// suppression expires.
+func (results Results) exclude(baseline Results) (remaining Results) {
+	known := make(map[string]bool)
+	for _, issue := range baseline.Unchanged {
+		known[issueKey(issue)] = true
+	}
+	for _, group := range baseline.byKind() {
+		for _, issue := range group {
+			known[issueKey(issue)] = true
+		}
+	}
+	var unchanged []Issue
+	remaining = results.each(func(issues []Issue) (changed []Issue) {
+		for _, issue := range issues {
+			if known[issueKey(issue)] {
+				unchanged = append(unchanged, issue)
+				continue
+			}
+			changed = append(changed, issue)
+		}
+		return
+	})
+	sortIssues(unchanged)
+	remaining.Unchanged = append(remaining.Unchanged, unchanged...)
+	return
+}
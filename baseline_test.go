@@ -0,0 +1,39 @@
+package subtocheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaselineExclude(t *testing.T) {
+	baseline := getIssuesSummary(issues{
+		{Kind: "dangling", FQDN: "a.example.com", CNAMEChain: []string{"a.example.net"}, Severity: "medium"},
+		{Kind: "vuln", FQDN: "b.example.com", Platform: "Heroku", Severity: "high"},
+	})
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeJSON(f, baseline); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	f.Close()
+	if baseline, err = LoadResults(path); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	results := getIssuesSummary(issues{
+		{Kind: "dangling", FQDN: "a.example.com", CNAMEChain: []string{"a.example.net"}, Severity: "medium"},
+		{Kind: "vuln", FQDN: "b.example.com", Platform: "Heroku", Severity: "critical"},
+		{Kind: "vuln", FQDN: "c.example.com", Platform: "Heroku", Severity: "high"},
+	})
+	remaining := results.exclude(baseline)
+	if len(remaining.Unchanged) != 1 || len(remaining.DanglingCNAMEs) != 0 || len(remaining.Vulnerabilities) != 2 {
+		t.Errorf("expected only new and changed issues, got: %+v", remaining)
+	}
+	// when these results are the next run's baseline, the unchanged issue is still excluded
+	if next := results.exclude(remaining); len(next.Unchanged) != 3 || len(next.DanglingCNAMEs) != 0 {
+		t.Errorf("expected unchanged issues to carry over, got: %+v", next)
+	}
+}
@@ -3,99 +3,211 @@ package subtocheck
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"reflect"
-
 	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
-	httpPrefix   = "http://"
-	httpsPrefix  = "https://"
-	protocols    = []string{"http", "https"}
-	resolveMutex sync.Mutex
-	nameservers  = []string{
-		"8.8.8.8",         // google
-		"8.8.4.4",         // google
-		"209.244.0.3",     // level3
-		"209.244.0.4",     // level3
-		"1.1.1.1",         // cloudflare
-		"1.0.0.1",         // cloudflare
-		"9.9.9.9",         // quad9
-		"149.112.112.112", // quad9
-	}
+	httpPrefix  = "http://"
+	httpsPrefix = "https://"
 )
 
-type issue struct {
-	kind     string // vuln, request, dns
-	platform string
-	fqdn     string
-	url      string
-	err      error
+// maxCNAMEHops limits how many CNAME records are followed before giving up
+const maxCNAMEHops = 10
+
+type issues []Issue
+
+// followCNAMEs walks the CNAME records in answer, starting at name, and returns the final target,
+// the targets of each hop followed and the A and AAAA addresses of the final target
+func followCNAMEs(name string, answer []dns.RR) (target string, hops []string, addresses []net.IP) {
+	target = name
+	for i := 0; i < len(answer); i++ {
+		var next string
+		for _, rr := range answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, target) {
+				next = cname.Target
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+		hops = append(hops, strings.TrimSuffix(next, "."))
+	}
+	for _, rr := range answer {
+		if !strings.EqualFold(rr.Header().Name, target) {
+			continue
+		}
+		switch record := rr.(type) {
+		case *dns.A:
+			addresses = append(addresses, record.A)
+		case *dns.AAAA:
+			addresses = append(addresses, record.AAAA)
+		}
+	}
+	return
+}
+
+// resolution is the outcome of resolving a name and following its CNAMEs
+type resolution struct {
+	chain []string
+	// nxdomain is true if the name, or the final target of its CNAMEs, does not exist
+	nxdomain bool
+	ipv4     []net.IP
+	ipv6     []net.IP
 }
 
-type issues []issue
+// addresses returns the IPv4 addresses followed by the IPv6 addresses
+func (res resolution) addresses() (addresses []string) {
+	for _, ip := range append(append([]net.IP{}, res.ipv4...), res.ipv6...) {
+		addresses = append(addresses, ip.String())
+	}
+	return
+}
 
-func checkResolves(fqdn string, debug *bool) (issues issues) {
-	c := new(dns.Client)
-	m := new(dns.Msg)
-	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeA)
-	m.RecursionDesired = true
-	c.Timeout = 1500 * time.Millisecond
-	var record *dns.Msg
+// lookupAAAA returns the IPv6 addresses of name, which must not be a CNAME
+func (s *Scanner) lookupAAAA(ctx context.Context, name string) (addresses []net.IP) {
+	record, _, _, err := s.exchange(ctx, name, dns.TypeAAAA)
+	if err != nil || record.Rcode != dns.RcodeSuccess {
+		return
+	}
+	_, _, addresses = followCNAMEs(name, record.Answer)
+	return
+}
+
+func (s *Scanner) checkResolves(ctx context.Context, fqdn string) (res resolution, issues issues) {
+	var chain []string
 	var err error
-	resolveMutex.Lock()
-	rand.Seed(time.Now().UnixNano())
-	ns := rand.Int() % len(nameservers)
-	if *debug {
-		fmt.Printf("DEBUG: resolving \"%s\" with nameserver %s\n", fqdn, nameservers[ns])
-	}
-	record, _, err = c.Exchange(m, net.JoinHostPort(nameservers[ns], strconv.Itoa(53)))
-	resolveMutex.Unlock()
-	if err != nil {
-		err = errors.Errorf("%s could not be resolved (%v)", fqdn, err)
-		issues = append(issues, issue{kind: "dns", fqdn: fqdn, err: err})
-	} else if len(record.Answer) == 0 {
-		err = errors.Errorf("%s could not be resolved (no answer from %s)", fqdn, nameservers[ns])
-		issues = append(issues, issue{kind: "dns", fqdn: fqdn, err: err})
-	} else if record.Rcode != 0 {
-		err = errors.Errorf("%s could not be resolved (%s from %s)", fqdn, dns.RcodeToString[record.Rcode],
-			nameservers[ns])
-		issues = append(issues, issue{kind: "dns", fqdn: fqdn, err: err})
-	}
-	if *debug && err != nil {
+	var disagreements []string
+	name := dns.Fqdn(fqdn)
+	for hop := 0; hop <= maxCNAMEHops && err == nil; hop++ {
+		var record *dns.Msg
+		var ns string
+		var hopDisagreements []string
+		record, ns, hopDisagreements, err = s.exchange(ctx, name, dns.TypeA)
+		disagreements = append(disagreements, hopDisagreements...)
+		if err != nil {
+			err = errors.Errorf("%s could not be resolved (%v)", fqdn, err)
+			issues = append(issues, Issue{Kind: "dns", FQDN: fqdn, CNAMEChain: chain, Error: err.Error()})
+			break
+		}
+		target, hops, addresses := followCNAMEs(name, record.Answer)
+		chain = append(chain, hops...)
+		switch {
+		case record.Rcode == dns.RcodeNameError && len(chain) > 0:
+			res.nxdomain = true
+			err = errors.Errorf("%s is a dangling CNAME (%s does not exist according to %s)", fqdn,
+				chain[len(chain)-1], ns)
+			issues = append(issues, checkDangling(fqdn, chain, s.opts.Fingerprints, err))
+		case record.Rcode != dns.RcodeSuccess:
+			res.nxdomain = record.Rcode == dns.RcodeNameError
+			err = errors.Errorf("%s could not be resolved (%s from %s)", fqdn, dns.RcodeToString[record.Rcode],
+				ns)
+			issues = append(issues, Issue{Kind: "dns", FQDN: fqdn, CNAMEChain: chain, Error: err.Error()})
+		case len(addresses) > 0:
+			res.chain = chain
+			res.ipv4 = addresses
+			res.ipv6 = s.lookupAAAA(ctx, target)
+			return
+		case len(hops) == 0:
+			// names without an A record may be IPv6 only
+			if res.ipv6 = s.lookupAAAA(ctx, target); len(res.ipv6) > 0 {
+				res.chain = chain
+				return
+			}
+			err = errors.Errorf("%s could not be resolved (no answer from %s)", fqdn, ns)
+			issues = append(issues, Issue{Kind: "dns", FQDN: fqdn, CNAMEChain: chain, Error: err.Error()})
+		}
+		// the answer ended part way along the chain so continue from the last target
+		name = target
+	}
+	if err == nil {
+		err = errors.Errorf("%s could not be resolved (more than %d CNAME hops)", fqdn, maxCNAMEHops)
+		issues = append(issues, Issue{Kind: "dns", FQDN: fqdn, CNAMEChain: chain, Error: err.Error()})
+	}
+	res.chain = chain
+	for i := range issues {
+		issues[i].ResolverDisagreements = disagreements
+	}
+	if s.opts.Debug && err != nil {
 		fmt.Printf("DEBUG: error: %v\n", err)
 	}
 
 	return
 }
 
-func checkResponse(fqdn string, protocols []string, debug *bool) (issues issues) {
-	var clientTransportTimeoutSecs = 3
-	var responseHeaderTimeoutSecs = 2
+// checkDangling returns a vuln issue if a dangling CNAME chain matches an nxdomain fingerprint, or a dangling issue
+// if it doesn't
+func checkDangling(fqdn string, chain []string, patterns []Fingerprint, danglingErr error) Issue {
+	for _, pattern := range patterns {
+		if pattern.NXDomain && pattern.matchesCNAME(chain) {
+			return Issue{
+				FQDN:       fqdn,
+				Kind:       "vuln",
+				Platform:   pattern.Platform,
+				Severity:   pattern.Severity,
+				Confidence: pattern.Confidence,
+				CNAMEChain: chain,
+				Error: fmt.Sprintf("matches pattern for platform: %s (%s does not exist)", pattern.Platform,
+					chain[len(chain)-1]),
+			}
+		}
+	}
+	return Issue{Kind: "dangling", FQDN: fqdn, CNAMEChain: chain, Error: danglingErr.Error()}
+}
+
+// dialResolved returns a DialContext function that connects to fqdn using the addresses it was resolved to,
+// so requests use the configured resolvers and the chosen address family. Other hosts, e.g. those redirected
+// to, are dialled normally.
+func (s *Scanner) dialResolved(fqdn string, addresses []net.IP) func(ctx context.Context, network,
+	addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.opts.HTTPTimeout}
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || !strings.EqualFold(host, fqdn) || len(addresses) == 0 {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if s.httpPort != "" {
+			port = s.httpPort
+		}
+		for _, ip := range addresses {
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return
+			}
+		}
+		return
+	}
+}
 
+func (s *Scanner) checkResponse(ctx context.Context, fqdn string, res resolution) (issues issues, responded bool) {
+	// prefer IPv4 and only make requests over IPv6 if the name has no IPv4 addresses
+	family, addresses := "ipv4", res.ipv4
+	if len(addresses) == 0 && len(res.ipv6) > 0 {
+		family, addresses = "ipv6", res.ipv6
+	}
 	tr := &http.Transport{
-		ResponseHeaderTimeout: time.Duration(responseHeaderTimeoutSecs) * time.Second,
+		DialContext:           s.dialResolved(fqdn, addresses),
+		ResponseHeaderTimeout: s.opts.ResponseHeaderTimeout,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 	}
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   time.Duration(clientTransportTimeoutSecs) * time.Second,
+		Timeout:   s.opts.HTTPTimeout,
 	}
-	for _, protocol := range protocols {
+	defer tr.CloseIdleConnections()
+	for _, protocol := range s.opts.Protocols {
 		var httpURL string
 		if protocol == "http" {
 			httpURL = httpPrefix + fqdn
@@ -104,138 +216,283 @@ func checkResponse(fqdn string, protocols []string, debug *bool) (issues issues)
 		}
 		var httpResp *http.Response
 		var err error
-		if *debug {
-			fmt.Printf("DEBUG: requesting URL \"%s\" with client transport timeout: %d secs and resp. header"+
-				" timeout: %d secs\n", httpURL, clientTransportTimeoutSecs, responseHeaderTimeoutSecs)
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: requesting URL \"%s\" over %s with client transport timeout: %v and resp. header"+
+				" timeout: %v\n", httpURL, family, s.opts.HTTPTimeout, s.opts.ResponseHeaderTimeout)
 		}
-		httpResp, err = client.Get(httpURL)
-		if err != nil {
-			issues = append(issues, issue{kind: "request", fqdn: fqdn, err: err})
-			continue
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, httpURL, nil)
+		if err == nil {
+			httpResp, err = client.Do(req)
 		}
-
-		if httpResp != nil && httpResp.Body != nil {
-			vulnIssue := checkVulnerable(httpURL, httpResp)
-			if vulnIssue.kind != "" {
-				issues = append(issues, vulnIssue)
+		if err != nil {
+			issues = append(issues, Issue{Kind: "request", FQDN: fqdn, URL: httpURL, Error: err.Error()})
+		} else if httpResp != nil && httpResp.Body != nil {
+			responded = true
+			body, readErr := readBody(httpResp.Body, s.opts.MaxBodySize)
+			if readErr != nil {
+				issues = append(issues, Issue{Kind: "request", FQDN: fqdn, URL: httpURL,
+					Error: fmt.Sprintf("failed to read response from %s (%v)", httpURL, readErr)})
+				continue
 			}
+			issues = append(issues, checkVulnerable(fqdn, httpURL, res.chain, httpResp.StatusCode, httpResp.Header, body,
+				s.opts.Fingerprints)...)
 		}
 	}
+	for i := range issues {
+		issues[i].AddressFamily = family
+		issues[i].Addresses = res.addresses()
+	}
 	return
 }
 
-type vPattern struct {
-	platform        string
-	responseCodes   []int // 0 for all
-	bodyStrings     []string
-	bodyStringMatch string
+// readBody reads up to maxSize bytes of the response body and closes it. Anything beyond maxSize is discarded
+// as fingerprints are expected to match near the start of the page.
+func readBody(body io.ReadCloser, maxSize int64) (content string, err error) {
+	defer body.Close()
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(io.LimitReader(body, maxSize)); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	content = buf.String()
+	return
 }
 
-var vPatterns = []vPattern{
-	{
-		platform: "Azure Front Door",
-		// <h2>Our services aren't available right now</h2><p>We're working to restore all services as soon as possible. Please check back soon.</p>
-		responseCodes:   []int{400},
-		bodyStrings:     []string{"Our services aren't available right now"},
-		bodyStringMatch: "all",
-	},
-	{
-		platform:        "Bitbucket",
-		bodyStrings:     []string{"Repository not found"},
-		bodyStringMatch: "all",
-	},
-	{
-		platform:        "Heroku",
-		responseCodes:   []int{404},
-		bodyStrings:     []string{"//www.herokucdn.com/error-pages/no-such-app.html", "No such app"},
-		bodyStringMatch: "any",
-	},
-	{
-		platform:        "S3",
-		responseCodes:   []int{404},
-		bodyStrings:     []string{"Code: NoSuchBucket", "The specified bucket does not exist"},
-		bodyStringMatch: "any",
-	},
-	{
-		platform:        "Tumblr",
-		responseCodes:   []int{404},
-		bodyStrings:     []string{"Not found.", "assets.tumblr.com", "Whatever you were looking for doesn't currently exist at this address"},
-		bodyStringMatch: "all",
-	},
+// checkVulnerable returns an issue for each fingerprint matching the response
+func checkVulnerable(fqdn, url string, chain []string, statusCode int, header http.Header, body string,
+	patterns []Fingerprint) (vulns issues) {
+	for _, pattern := range patterns {
+		if !pattern.checksResponse() || pattern.requiresCNAME() && !pattern.matchesCNAME(chain) {
+			continue
+		}
+		if pattern.matchesResponse(statusCode, header, body) {
+			vulns = append(vulns, Issue{
+				FQDN:       fqdn,
+				URL:        url,
+				Kind:       "vuln",
+				Platform:   pattern.Platform,
+				Severity:   pattern.Severity,
+				Confidence: pattern.Confidence,
+				CNAMEChain: chain,
+				StatusCode: statusCode,
+				Error:      fmt.Sprintf("matches pattern for platform: %s", pattern.Platform),
+			})
+		}
+	}
+	return
 }
 
-func checkVulnerable(url string, response *http.Response) (vuln issue) {
-	for _, pattern := range vPatterns {
-		if len(pattern.responseCodes) > 0 {
-			if pattern.responseCodes == nil || !contains(pattern.responseCodes, response.StatusCode) {
-				continue
-			}
+func readDomains(path string) (domains []string, err error) {
+	var file *os.File
+	file, err = os.Open(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	defer file.Close()
+	domainScanner := bufio.NewScanner(file)
+	for domainScanner.Scan() {
+		entry := strings.TrimSpace(domainScanner.Text())
+		if entry != "" {
+			domains = append(domains, entry)
 		}
-		if checkBodyResponse(pattern, response.Body) {
-			return issue{
-				url:      url,
-				kind:     "vuln",
-				platform: pattern.platform,
-				err:      errors.Errorf("matches pattern for platform: %s", pattern.platform),
+	}
+	err = errors.WithStack(domainScanner.Err())
+	return
+}
+
+// getResolvers combines the nameservers listed in the configuration with those in the resolvers file and
+// the system configuration. An empty list means the default public resolvers are used.
+func getResolvers(conf resolversConfig) (resolvers []string, err error) {
+	for _, nameserver := range conf.Nameservers {
+		// allow comma separated lists, e.g. --resolvers 10.0.0.2,10.0.0.3
+		for _, resolver := range strings.Split(nameserver, ",") {
+			if resolver = strings.TrimSpace(resolver); resolver != "" {
+				resolvers = append(resolvers, resolver)
 			}
 		}
 	}
+	if conf.File != "" {
+		var fileResolvers []string
+		if fileResolvers, err = LoadResolvers(conf.File); err != nil {
+			return nil, errors.Wrapf(err, "failed to load resolvers: \"%s\"", conf.File)
+		}
+		resolvers = append(resolvers, fileResolvers...)
+	}
+	if conf.System {
+		var systemResolvers []string
+		if systemResolvers, err = SystemResolvers(SystemResolvConf); err != nil {
+			return nil, errors.Wrap(err, "failed to load system resolvers")
+		}
+		resolvers = append(resolvers, systemResolvers...)
+	}
 	return
 }
 
-func checkBodyResponse(pattern vPattern, body io.ReadCloser) (result bool) {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(body)
-	if err != nil {
-		fmt.Printf("%+v\n", err)
-		os.Exit(1)
-	}
-	bodyText := buf.String()
-	for _, bodyString := range pattern.bodyStrings {
-		if strings.Contains(bodyText, bodyString) {
-			result = true
-		} else if pattern.bodyStringMatch == "all" {
-			result = false
+var (
+	// ErrVulnerabilities is returned by CheckDomains when potential takeovers (vuln, dangling, ip or mx issues)
+	// that are set to fail the check are found
+	ErrVulnerabilities = errors.New("potential vulnerabilities found")
+	// ErrIssues is returned by CheckDomains when only DNS or request issues that are set to fail the check are found
+	ErrIssues = errors.New("DNS or request issues found")
+)
+
+// DefaultFailOn are the kinds of issue that fail the check if FailOn isn't set. Issues with informational
+// confidence, e.g. MX hosts at mail providers that are still configured, only fail it if their kind is set.
+var DefaultFailOn = []string{"vuln", "dangling", "ip", "mx"}
+
+// validateFailOn returns an error if any of the values isn't a kind of issue, "all" or "none"
+func validateFailOn(failOn []string) error {
+	for _, kind := range failOn {
+		if _, ok := defaultRatings[kind]; !ok && kind != "all" && kind != "none" {
+			return errors.Errorf("invalid fail on '%s', must be a kind of issue, 'all' or 'none'", kind)
+		}
+	}
+	return nil
+}
+
+// failOnError returns ErrVulnerabilities if the results contain any potential takeovers of the kinds in failOn,
+// or ErrIssues if they only contain DNS or request issues of those kinds. If failOn is empty, DefaultFailOn is used.
+func failOnError(results Results, failOn []string) (err error) {
+	if len(failOn) == 0 {
+		failOn = DefaultFailOn
+		results = results.each(func(issues []Issue) (checked []Issue) {
+			for _, issue := range issues {
+				if issue.Confidence != "informational" {
+					checked = append(checked, issue)
+				}
+			}
 			return
+		})
+	}
+	grouped := results.byKind()
+	for _, kind := range failOn {
+		kinds := []string{kind}
+		if kind == "all" {
+			kinds = []string{"vuln", "dangling", "ip", "mx", "dns", "request"}
+		}
+		for _, kind := range kinds {
+			if len(grouped[kind]) == 0 {
+				continue
+			}
+			if kind != "dns" && kind != "request" {
+				return ErrVulnerabilities
+			}
+			err = ErrIssues
 		}
 	}
 	return
 }
 
-var domainIssues issues
+// CheckDomainsInput contains the command line options passed to CheckDomains
+type CheckDomainsInput struct {
+	DomainsPath      string
+	ConfigPath       string
+	FingerprintsPath string
+	Output           string // text or json
+	OutputFile       string
+	Workers          int
+	Resolvers        []string
+	ResolversFile    string
+	SystemResolvers  bool
+	ResolverQPS      float64
+	DNSRetries       int
+	Consensus        int
+	CheckNS          bool
+	CheckMX          bool
+	IPRangesPaths    []string
+	MaxBodySize      int64
+	Debug            bool
+	Quiet            bool
+	// BaselinePath, if set, is a previous JSON result. Issues in it aren't reported again.
+	BaselinePath string
+	// SuppressionsPath, if set, is a file of suppressions. Matching issues are only listed as suppressed.
+	SuppressionsPath string
+	// StateDir, if set, is the directory a snapshot of the results is written to after each run
+	StateDir string
+	// NotifyDryRun, if set, is the directory notifications are written to instead of being sent
+	NotifyDryRun string
+	// MinSeverity, if set, excludes issues below this severity
+	MinSeverity string
+	// FailOn are the kinds of issue that cause an error to be returned if found, "all" or "none" (default
+	// DefaultFailOn, without issues with informational confidence)
+	FailOn []string
+}
 
 // CheckDomains is called from cmd/subtocheck/main.go to kick off the scans
-func CheckDomains(path string, configPath *string, debug *bool, quiet *bool) {
+func CheckDomains(input CheckDomainsInput) (err error) {
+	if input.MinSeverity != "" {
+		if err = ValidateSeverity(input.MinSeverity); err != nil {
+			return
+		}
+	}
+	if err = validateFailOn(input.FailOn); err != nil {
+		return
+	}
 	var conf config
-	if *configPath != "" {
-		conf = readConfig(*configPath)
+	if input.ConfigPath != "" {
+		if conf, err = readConfig(input.ConfigPath); err != nil {
+			return
+		}
 	}
-	file, _ := os.Open(path)
-	domainScanner := bufio.NewScanner(file)
-	var domains []string
-	for domainScanner.Scan() {
-		entry := domainScanner.Text()
-		if entry != "" {
-			domains = append(domains, entry)
+	if input.FingerprintsPath != "" {
+		conf.Fingerprints = input.FingerprintsPath
+	}
+	if len(input.Resolvers) > 0 {
+		conf.Resolvers.Nameservers = input.Resolvers
+	}
+	if input.ResolversFile != "" {
+		conf.Resolvers.File = input.ResolversFile
+	}
+	if input.SystemResolvers {
+		conf.Resolvers.System = true
+	}
+	if len(input.IPRangesPaths) > 0 {
+		conf.IPRanges = input.IPRangesPaths
+	}
+	if input.SuppressionsPath != "" {
+		conf.Suppressions = input.SuppressionsPath
+	}
+	opts := Options{
+		Workers:     input.Workers,
+		ResolverQPS: input.ResolverQPS,
+		Retries:     input.DNSRetries,
+		Consensus:   input.Consensus,
+		CheckNS:     input.CheckNS,
+		CheckMX:     input.CheckMX,
+		MaxBodySize: input.MaxBodySize,
+		Debug:       input.Debug,
+	}
+	// validate everything up front, rather than finding problems with, e.g. email settings, after the scan
+	var loaded loadedConfig
+	if loaded, err = loadConfig(conf); err != nil {
+		return
+	}
+	opts.Resolvers, opts.IPRanges, opts.Fingerprints = loaded.resolvers, loaded.ipRanges, loaded.fingerprints
+	var baseline Results
+	if input.BaselinePath != "" {
+		if baseline, err = LoadResults(input.BaselinePath); err != nil {
+			return
 		}
 	}
-	jobs := make(chan string, len(domains))
-	results := make(chan bool, len(domains))
-
-	for w := 1; w <= 10; w++ {
-		go worker(w, jobs, results, debug)
+	var domains []string
+	if domains, err = readDomains(input.DomainsPath); err != nil {
+		return errors.Wrapf(err, "failed to read domains: \"%s\"", input.DomainsPath)
 	}
-	numDomains := len(domains)
-	for j := 0; j < numDomains; j++ {
-		jobs <- domains[j]
+	var out io.Writer = os.Stdout
+	if input.OutputFile != "" {
+		var f *os.File
+		if f, err = os.Create(input.OutputFile); err != nil {
+			return errors.Wrapf(err, "failed to create output file: \"%s\"", input.OutputFile)
+		}
+		defer f.Close()
+		out = f
 	}
-	close(jobs)
-
-	var progress string
-	for a := 1; a <= numDomains; a++ {
-		if !*quiet {
-			progress = fmt.Sprintf("Processing... %d/%d %s", a, numDomains, domains[a-1])
-			progress = padToWidth(progress, true)
+	// progress is only shown when results are written to a file or as text to the console
+	if !input.Quiet && (input.OutputFile != "" || input.Output != "json") {
+		opts.Progress = func(done, total int, fqdn string) {
+			progress := padToWidth(fmt.Sprintf("Processing... %d/%d %s", done, total, fqdn), true)
 			width, _, _ := terminal.GetSize(0)
 			if len(progress) == width {
 				fmt.Printf(progress[0:width-3] + "   \r")
@@ -243,64 +500,55 @@ func CheckDomains(path string, configPath *string, debug *bool, quiet *bool) {
 				fmt.Print(progress)
 			}
 		}
-
-		<-results
 	}
-	pIssues := getIssuesSummary(domainIssues)
-	var noIssuesFound, noVulnsFound bool
-
-	if !*quiet {
-		fmt.Printf("%s", padToWidth(" ", false))
-		if !reflect.DeepEqual(pIssues, processedIssues{}) {
-			displayIssues(pIssues)
-			if len(pIssues.potVulns) == 0 {
-				noVulnsFound = true
-			}
-		} else {
-			noIssuesFound = true
-			fmt.Println("\nno issues found.")
-		}
-	}
-	// send notifications
-	if noIssuesFound {
-		if *debug {
-			fmt.Println("\nDEBUG: no issues found. skipping email.")
-		}
+	var scanner *Scanner
+	if scanner, err = NewScanner(opts); err != nil {
 		return
 	}
-	if conf.Email.SkipNoVulns && noVulnsFound {
-		if *debug {
-			fmt.Println("\nDEBUG: no vulnerabilities found. skipping email.")
-		}
+	var pIssues Results
+	if pIssues, err = scanner.Check(context.Background(), domains); err != nil {
 		return
 	}
-	if conf.Email.Provider != "" {
-		if *debug {
-			fmt.Println("\nDEBUG: sending email")
+	pIssues = pIssues.suppress(loaded.suppressions, time.Now().UTC())
+	if input.StateDir != "" {
+		conf.StateDir = input.StateDir
+	}
+	if conf.StateDir != "" {
+		// snapshots include every issue so later runs can be compared regardless of how they're filtered
+		var snapshot string
+		if snapshot, err = SaveSnapshot(conf.StateDir, pIssues); err != nil {
+			return errors.Wrap(err, "failed to save snapshot")
 		}
-		emailErr := emailResults(conf.Email, pIssues)
-		if emailErr != nil {
-			fmt.Println("failed to send email")
-			fmt.Println("-- error --")
-			fmt.Printf("%+v\n", emailErr)
+		if input.Debug {
+			fmt.Printf("DEBUG: saved snapshot: %s\n", snapshot)
 		}
 	}
-}
+	if input.BaselinePath != "" {
+		pIssues = pIssues.exclude(baseline)
+	}
+	if input.MinSeverity != "" {
+		pIssues = pIssues.filter(input.MinSeverity)
+	}
+	noIssuesFound := pIssues.empty()
 
-func worker(id int, jobs <-chan string, results chan<- bool, debug *bool) {
-	for j := range jobs {
-		if *debug {
-			fmt.Printf("DEBUG: worker: %d\n", id)
-		}
-		resolveIssues := checkResolves(j, debug)
-		if len(resolveIssues) > 0 {
-			domainIssues = append(domainIssues, resolveIssues...)
-		} else {
-			responseIssues := checkResponse(j, protocols, debug)
-			if len(responseIssues) > 0 {
-				domainIssues = append(domainIssues, responseIssues...)
+	if opts.Progress != nil {
+		fmt.Printf("%s", padToWidth(" ", false))
+	}
+	if !input.Quiet || input.OutputFile != "" {
+		switch {
+		case input.Output == "json":
+			if err = writeJSON(out, pIssues); err != nil {
+				return errors.Wrap(err, "failed to write results")
 			}
+		case noIssuesFound:
+			fmt.Fprintln(out, "\nno issues found.")
+			displaySuppressed(out, pIssues)
+		default:
+			displayIssues(out, pIssues)
 		}
-		results <- true
 	}
+	if err = notify(context.Background(), loaded.notifications, pIssues, input.NotifyDryRun, input.Debug); err != nil {
+		return
+	}
+	return failOnError(pIssues, input.FailOn)
 }
@@ -0,0 +1,165 @@
+package subtocheck
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+func TestFollowCNAMEs(t *testing.T) {
+	var answer []dns.RR
+	for _, record := range []string{
+		"www.example.com. 300 IN CNAME app.example.net.",
+		"app.example.net. 300 IN CNAME app.herokuapp.com.",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer = append(answer, rr)
+	}
+	target, hops, addresses := followCNAMEs("www.example.com.", answer)
+	if target != "app.herokuapp.com." {
+		t.Errorf("unexpected target: %s", target)
+	}
+	if len(hops) != 2 || hops[0] != "app.example.net" || hops[1] != "app.herokuapp.com" {
+		t.Errorf("unexpected hops: %v", hops)
+	}
+	if len(addresses) != 0 {
+		t.Error("chain without an address record should not be resolved")
+	}
+	a, _ := dns.NewRR("app.herokuapp.com. 300 IN A 192.0.2.1")
+	aaaa, _ := dns.NewRR("app.herokuapp.com. 300 IN AAAA 2001:db8::1")
+	if _, _, addresses = followCNAMEs("www.example.com.", append(answer, a, aaaa)); len(addresses) != 2 {
+		t.Errorf("expected chain to resolve to both addresses, got: %v", addresses)
+	}
+}
+
+func TestCheckDangling(t *testing.T) {
+	patterns, err := DefaultFingerprints()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	danglingErr := errors.New("dangling")
+	result := checkDangling("www.example.com", []string{"example.azurewebsites.net"}, patterns, danglingErr)
+	if result.Kind != "vuln" || result.Platform != "Azure" {
+		t.Errorf("expected Azure vuln, got: %+v", result)
+	}
+	result = checkDangling("www.example.com", []string{"www.example.net"}, patterns, danglingErr)
+	if result.Kind != "dangling" || result.Error != "dangling" {
+		t.Errorf("expected dangling issue, got: %+v", result)
+	}
+}
+
+func TestCheckVulnerable(t *testing.T) {
+	patterns, err := parseFingerprints([]byte(`
+- platform: First
+  bodyStrings: ["not found"]
+  responseCodes: [404]
+- platform: Second
+  bodyStrings: ["no such app"]
+- platform: Third
+  bodyStrings: ["no such bucket"]
+`), false)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	vulns := checkVulnerable("www.example.com", "http://www.example.com", nil, http.StatusNotFound, nil,
+		"not found: no such app", patterns)
+	if len(vulns) != 2 || vulns[0].Platform != "First" || vulns[1].Platform != "Second" {
+		t.Errorf("expected First and Second to match, got: %+v", vulns)
+	}
+	vulns = checkVulnerable("www.example.com", "http://www.example.com", nil, http.StatusOK, nil,
+		"no such bucket", patterns)
+	if len(vulns) != 1 || vulns[0].Platform != "Third" {
+		t.Errorf("expected only Third to match, got: %+v", vulns)
+	}
+}
+
+func TestFailOnError(t *testing.T) {
+	vulns := Results{Vulnerabilities: []Issue{{Kind: "vuln"}}, DNS: []Issue{{Kind: "dns"}}}
+	dnsOnly := Results{DNS: []Issue{{Kind: "dns"}}}
+	// an MX host at a mail provider that's still configured
+	mxProvider := Results{MX: []Issue{{Kind: "mx", Confidence: "informational"}}}
+	for _, test := range []struct {
+		results  Results
+		failOn   []string
+		expected error
+	}{
+		{vulns, DefaultFailOn, ErrVulnerabilities},
+		{dnsOnly, DefaultFailOn, nil},
+		{vulns, nil, ErrVulnerabilities},
+		{mxProvider, nil, nil},
+		{mxProvider, []string{"mx"}, ErrVulnerabilities},
+		{dnsOnly, []string{"dns"}, ErrIssues},
+		{dnsOnly, []string{"all"}, ErrIssues},
+		{vulns, []string{"dns", "vuln"}, ErrVulnerabilities},
+		{vulns, []string{"none"}, nil},
+		{Results{}, []string{"all"}, nil},
+	} {
+		if err := failOnError(test.results, test.failOn); err != test.expected {
+			t.Errorf("fail on %v: expected %v, got: %v", test.failOn, test.expected, err)
+		}
+	}
+	if err := validateFailOn([]string{"vuln", "typo"}); err == nil {
+		t.Error("expected error for invalid kind")
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	body, err := readBody(io.NopCloser(strings.NewReader("0123456789")), 4)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if body != "0123" {
+		t.Errorf("expected body to be truncated, got: %s", body)
+	}
+	if _, err = readBody(io.NopCloser(iotest.ErrReader(errors.New("reset"))), 4); err == nil {
+		t.Error("expected read error")
+	}
+}
+
+func TestScannerCheckIPv6Only(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 not available: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("<html><title>No such app</title></html>"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	resolver := startTestDNSServer(t, map[string][]string{
+		"app.example.com.":   {"CNAME app.herokuapp.com."},
+		"app.herokuapp.com.": {"AAAA ::1"},
+	})
+	scanner, err := NewScanner(Options{Resolvers: []string{resolver}, Protocols: []string{"http"}})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	scanner.httpPort = port
+	results, err := scanner.Check(context.Background(), []string{"app.example.com"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(results.Vulnerabilities) != 1 {
+		t.Fatalf("expected a vulnerability, got: %+v", results)
+	}
+	vuln := results.Vulnerabilities[0]
+	if vuln.Platform != "Heroku" || vuln.AddressFamily != "ipv6" || len(vuln.Addresses) != 1 ||
+		vuln.Addresses[0] != "::1" {
+		t.Errorf("unexpected vulnerability: %+v", vuln)
+	}
+}
@@ -27,12 +27,47 @@ import (
 )
 
 var (
+	checkCmd    = kingpin.Command("check", "check domains for potential subdomain takeovers").Default()
+	diffCmd     = kingpin.Command("diff", "show issues that appeared, disappeared or changed platform between two runs")
+	diffFrom    = diffCmd.Arg("from", "earlier JSON results (default the second most recent snapshot in --state-dir)").String()
+	diffTo      = diffCmd.Arg("to", "later JSON results (default the most recent snapshot in --state-dir)").String()
+	validateCmd = kingpin.Command("validate-config", "check the config file, and the files it refers to, listing every problem")
+
 	domainListPath = kingpin.Flag("domains", "domain list file path").Default("domains.txt").String()
 	configPath     = kingpin.Flag("config", "config file").String()
+	fingerprints   = kingpin.Flag("fingerprints", "fingerprints file path (YAML or JSON)").String()
+	output         = kingpin.Flag("output", "output format").Default("text").Enum("text", "json")
+	outputFile     = kingpin.Flag("output-file", "write results to file instead of the console").String()
+	workers        = kingpin.Flag("workers", "number of domains to check concurrently").Default("10").Int()
+	resolvers      = kingpin.Flag("resolvers", "resolver to query as host or host:port (repeatable or comma separated)").Strings()
+	resolversFile  = kingpin.Flag("resolvers-file", "file containing resolvers to query, one per line").String()
+	systemResolver = kingpin.Flag("system-resolvers", "query the resolvers in /etc/resolv.conf").Bool()
+	resolverQPS    = kingpin.Flag("resolver-qps", "maximum queries per second to each resolver (0 for unlimited)").Default("0").Float64()
+	dnsRetries     = kingpin.Flag("dns-retries", "times to retry a DNS query that times out or fails").Default("2").Int()
+	consensus      = kingpin.Flag("consensus", "number of resolvers to query, only reporting failures the majority agree on").Default("0").Int()
+	checkNS        = kingpin.Flag("check-ns", "check for NS delegations to lame nameservers").Bool()
+	checkMX        = kingpin.Flag("check-mx", "check for MX hosts that don't exist or belong to mail providers").Bool()
+	ipRanges       = kingpin.Flag("ip-ranges", "cloud provider IP ranges file, e.g. AWS ip-ranges.json (repeatable)").Strings()
+	maxBodySize    = kingpin.Flag("max-body-size", "maximum bytes of each response body to match fingerprints against").Default("1048576").Int64()
+	baseline       = kingpin.Flag("baseline", "previous JSON results file; only issues that are new or changed since are reported").String()
+	suppressions   = kingpin.Flag("suppressions", "file of accepted issues to list as suppressed").String()
+	stateDir       = kingpin.Flag("state-dir", "directory to save a snapshot of the results of each run to, for diff").String()
+	notifyDryRun   = kingpin.Flag("notify-dry-run", "write notifications, e.g. emails as .eml files, to this directory and print them instead of sending them").String()
+	minSeverity    = kingpin.Flag("min-severity", "only report issues of at least this severity").Enum("info", "low", "medium", "high", "critical")
+	failOn         = kingpin.Flag("fail-on", "kind of issue that causes a non-zero exit status: vuln, dangling, ip, mx, dns, request, all or none (repeatable, default vuln, dangling, ip and mx, except informational provider matches)").Enums("vuln", "dangling", "ip", "mx", "dns", "request", "all", "none")
 	quiet          = kingpin.Flag("quiet", "suppress command line output").Bool()
 	debug          = kingpin.Flag("debug", "enable debug").Bool()
 )
 
+// exit statuses. Findings don't use 2, which the Go runtime exits with on a panic, so a crash can't be mistaken
+// for potential takeovers.
+const (
+	exitOK              = 0  // no issues that fail the check were found
+	exitError           = 1  // the check could not be completed, e.g. invalid config or unreadable domains file
+	exitVulnerabilities = 10 // potential takeovers were found
+	exitIssues          = 11 // only DNS or request issues were found
+)
+
 // overwritten at build time
 var version, versionOutput, tag, sha, buildDate string
 
@@ -87,6 +122,54 @@ Commands:
 {{end}}\
 `
 
+func check() error {
+	if *quiet && *configPath == "" && *outputFile == "" {
+		fmt.Println("warning: running without console output and without email config ¯\\_(ツ)_/¯")
+	}
+
+	domainsPath, err := getDomainListFilePath(*domainListPath)
+	if err != nil {
+		return err
+	}
+	return subtocheck.CheckDomains(subtocheck.CheckDomainsInput{
+		DomainsPath:      domainsPath,
+		ConfigPath:       *configPath,
+		FingerprintsPath: *fingerprints,
+		Output:           *output,
+		OutputFile:       *outputFile,
+		Workers:          *workers,
+		Resolvers:        *resolvers,
+		ResolversFile:    *resolversFile,
+		SystemResolvers:  *systemResolver,
+		ResolverQPS:      *resolverQPS,
+		DNSRetries:       *dnsRetries,
+		Consensus:        *consensus,
+		CheckNS:          *checkNS,
+		CheckMX:          *checkMX,
+		IPRangesPaths:    *ipRanges,
+		MaxBodySize:      *maxBodySize,
+		BaselinePath:     *baseline,
+		SuppressionsPath: *suppressions,
+		StateDir:         *stateDir,
+		NotifyDryRun:     *notifyDryRun,
+		MinSeverity:      *minSeverity,
+		FailOn:           *failOn,
+		Debug:            *debug,
+		Quiet:            *quiet,
+	})
+}
+
+func validateConfig() error {
+	if *configPath == "" {
+		return errors.New("config file not specified, use --config")
+	}
+	if err := subtocheck.ValidateConfig(*configPath); err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid\n", *configPath)
+	return nil
+}
+
 func main() {
 	if tag != "" && buildDate != "" {
 		versionOutput = fmt.Sprintf("[%s-%s] %s UTC", tag, sha, buildDate)
@@ -95,18 +178,34 @@ func main() {
 	}
 	kingpin.Version(versionOutput)
 	kingpin.CommandLine.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 	kingpin.UsageTemplate(usageTemplate)
 
-	if *quiet && *configPath == "" {
-		fmt.Println("warning: running without console output and without email config ¯\\_(ツ)_/¯")
+	var err error
+	switch command {
+	case diffCmd.FullCommand():
+		err = subtocheck.DiffRuns(subtocheck.DiffInput{
+			StateDir:   *stateDir,
+			ConfigPath: *configPath,
+			From:       *diffFrom,
+			To:         *diffTo,
+			Output:     *output,
+		})
+	case validateCmd.FullCommand():
+		err = validateConfig()
+	case checkCmd.FullCommand():
+		err = check()
 	}
-
-	var domainsPath string
-	domainsPath, err := getDomainListFilePath(*domainListPath)
-	if err != nil {
-		panic(err)
-	} else {
-		subtocheck.CheckDomains(domainsPath, configPath, debug, quiet)
+	switch {
+	case err == nil:
+		os.Exit(exitOK)
+	case errors.Is(err, subtocheck.ErrVulnerabilities):
+		os.Exit(exitVulnerabilities)
+	case errors.Is(err, subtocheck.ErrIssues):
+		os.Exit(exitIssues)
+	default:
+		fmt.Println(" -- error --")
+		fmt.Printf("%+v\n", err)
+		os.Exit(exitError)
 	}
 }
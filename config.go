@@ -3,16 +3,36 @@ package subtocheck
 import (
 	"fmt"
 	"io/ioutil"
-
-	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
 type config struct {
-	Defined bool
-	Email   emailConfig `yaml:"email"`
+	Defined       bool
+	Email         emailConfig          `yaml:"email"`
+	Fingerprints  string               `yaml:"fingerprints"`
+	Resolvers     resolversConfig      `yaml:"resolvers"`
+	IPRanges      []string             `yaml:"ip_ranges"`
+	Suppressions  string               `yaml:"suppressions"`
+	StateDir      string               `yaml:"state_dir"`
+	Notifications []notificationConfig `yaml:"notifications"`
+}
+
+// notificationConfig is a destination the results of each run are sent to
+type notificationConfig struct {
+	Type        string            `yaml:"type"`    // email, slack, teams or webhook
+	URL         string            `yaml:"url"`     // slack, teams and webhook
+	Headers     map[string]string `yaml:"headers"` // webhook
+	Email       emailConfig       `yaml:"email"`
+	SkipNoVulns bool              `yaml:"skip_no_vulns"`
+}
+
+type resolversConfig struct {
+	Nameservers []string
+	File        string
+	System      bool
 }
 
 type emailConfig struct {
@@ -28,11 +48,16 @@ type emailConfig struct {
 	Source             string
 	Subject            string
 	Recipients         []string
-	SkipNoVulns        bool `yaml:"skip_no_vulns"`
+	SkipNoVulns        bool   `yaml:"skip_no_vulns"`
+	HTMLTemplate       string `yaml:"html_template"`     // path of an html/template, instead of the default
+	TextTemplate       string `yaml:"text_template"`     // path of a text/template, instead of the default
+	AttachmentFormat   string `yaml:"attachment_format"` // text (default), csv or json
+	Directory          string `yaml:"directory"`         // file provider only
 }
 
 func parseConfigFileContent(content []byte) (config config, err error) {
-	unmarshalErr := yaml.Unmarshal(content, &config)
+	// unknown keys are errors so that misspelt settings aren't silently ignored
+	unmarshalErr := yaml.UnmarshalStrict(content, &config)
 	if unmarshalErr != nil {
 		err = errors.WithStack(unmarshalErr)
 		return
@@ -40,22 +65,72 @@ func parseConfigFileContent(content []byte) (config config, err error) {
 	return
 }
 
-func readConfig(path string) (config config) {
+func readConfig(path string) (config config, err error) {
 	var configFileContent []byte
-	var err error
 	configFileContent, err = ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Printf("failed to read: \"%s\"\n", path)
-		fmt.Println(" -- error --")
-		fmt.Printf("%+v\n", err)
-		os.Exit(1)
+		err = errors.Wrapf(err, "failed to read: \"%s\"", path)
+		return
 	}
 	config, err = parseConfigFileContent(configFileContent)
 	if err != nil {
-		fmt.Printf("failed to parse configuration: \"%s\"\n", path)
-		fmt.Println(" -- error --")
-		fmt.Printf("%+v\n", err)
-		os.Exit(1)
+		err = errors.Wrapf(err, "failed to parse configuration: \"%s\"", path)
+	}
+	return
+}
+
+// loadedConfig is the configuration with the files it refers to loaded
+type loadedConfig struct {
+	resolvers     []string
+	ipRanges      []IPRange
+	fingerprints  []Fingerprint
+	notifications []notification
+	suppressions  []Suppression
+}
+
+// loadConfig loads the files the configuration refers to and validates its settings, returning an error listing
+// every problem found so they can all be fixed before the scan is run
+func loadConfig(conf config) (loaded loadedConfig, err error) {
+	var problems []string
+	if loaded.resolvers, err = getResolvers(conf.Resolvers); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, ipRangesPath := range conf.IPRanges {
+		var ranges []IPRange
+		if ranges, err = LoadIPRanges(ipRangesPath); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		loaded.ipRanges = append(loaded.ipRanges, ranges...)
+	}
+	if conf.Fingerprints != "" {
+		if loaded.fingerprints, err = LoadFingerprints(conf.Fingerprints); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to load fingerprints: \"%s\": %v", conf.Fingerprints,
+				err))
+		}
+	}
+	var notificationProblems []string
+	loaded.notifications, notificationProblems = getNotifications(conf)
+	problems = append(problems, notificationProblems...)
+	if conf.Suppressions != "" {
+		if loaded.suppressions, err = LoadSuppressions(conf.Suppressions); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	err = nil
+	if len(problems) > 0 {
+		err = errors.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return
+}
+
+// ValidateConfig is called from cmd/subtocheck/main.go to check the configuration file at path, and the files it
+// refers to, without running a scan
+func ValidateConfig(path string) (err error) {
+	var conf config
+	if conf, err = readConfig(path); err != nil {
+		return
 	}
+	_, err = loadConfig(conf)
 	return
 }
@@ -0,0 +1,57 @@
+package subtocheck
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	conf, err := parseConfigFileContent([]byte(`
+email:
+  provider: smtp
+  port: "smtp"
+  source: "From <from@example.com"
+  recipients:
+    - not-an-address
+  attachment_format: xml
+fingerprints: missing-fingerprints.yaml
+suppressions: missing-suppressions.yaml
+notifications:
+  - type: slack
+  - type: email
+    email:
+      provider: file
+      source: from@example.com
+`))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, err = loadConfig(conf)
+	if err == nil {
+		t.Fatal("expected invalid configuration")
+	}
+	// every problem should be listed, not just the first
+	for _, expected := range []string{"email: email host not specified", "email: invalid email port 'smtp'",
+		"email: invalid email address 'not-an-address'",
+		"email: invalid email address 'From <from@example.com'", "email: unsupported attachment format 'xml'",
+		"missing-fingerprints.yaml", "missing-suppressions.yaml", "notification 1: slack: url not specified",
+		"notification 2: email: email directory not specified"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q:\n%s", expected, err)
+		}
+	}
+
+	if _, err = parseConfigFileContent([]byte("notificatons:\n  - type: slack\n")); err == nil ||
+		!strings.Contains(err.Error(), "notificatons") {
+		t.Errorf("expected error for unknown key, got: %v", err)
+	}
+	if _, err = loadConfig(config{Email: emailConfig{Provider: "ses", Source: "from@example.com",
+		Recipients: []string{"to@example.com"}}}); err == nil || !strings.Contains(err.Error(), "region") {
+		t.Errorf("expected error for missing SES region, got: %v", err)
+	}
+
+	if _, err = loadConfig(config{Email: emailConfig{Provider: "smtp", Host: "smtp.example.com", Port: "465",
+		Source: "from@example.com", Recipients: []string{"Alerts <alerts@example.com>"}}}); err != nil {
+		t.Errorf("%+v", err)
+	}
+}
@@ -1,59 +1,100 @@
 package subtocheck
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strings"
+)
 
-type processedIssues struct {
-	potVulns []issue
-	DNS      []issue
-	request  []issue
+// issueLocation returns the URL an issue was found at or, for issues found without a request, the fqdn
+func issueLocation(issue Issue) string {
+	if issue.URL != "" {
+		return issue.URL
+	}
+	return issue.FQDN
 }
 
-func getIssuesSummary(issues issues) (pIssues processedIssues) {
-	for _, issue := range issues {
-		switch issue.kind {
-		case "request":
-			pIssues.request = append(pIssues.request, issue)
-		case "dns":
-			pIssues.DNS = append(pIssues.DNS, issue)
-		case "vuln":
-			pIssues.potVulns = append(pIssues.potVulns, issue)
-		}
-	}
-	return
+// formatRating returns the issue's severity and confidence, e.g. "[high/likely]"
+func formatRating(issue Issue) string {
+	return fmt.Sprintf("[%s/%s]", issue.Severity, issue.Confidence)
 }
 
-func displayIssues(pIssues processedIssues) {
+// formatCNAMEChain returns the fqdn followed by each CNAME hop, e.g. "a.example.com -> a.herokuapp.com"
+func formatCNAMEChain(fqdn string, chain []string) string {
+	return strings.Join(append([]string{fqdn}, chain...), " -> ")
+}
+
+func displayIssues(w io.Writer, results Results) {
 	var txtNoIssuesFound = "none found"
 
-	fmt.Printf("\nRequest issues\n--------------\n")
-	if len(pIssues.request) > 0 {
-		for _, issue := range pIssues.request {
-			if issue.kind == "request" {
-				fmt.Printf("%v\n", issue.err)
-			}
+	fmt.Fprintf(w, "\nRequest issues\n--------------\n")
+	if len(results.Request) > 0 {
+		for _, issue := range results.Request {
+			fmt.Fprintf(w, "%s %s\n", formatRating(issue), issue.Error)
 		}
 	} else {
-		fmt.Println(txtNoIssuesFound)
+		fmt.Fprintln(w, txtNoIssuesFound)
 	}
 
-	fmt.Printf("\nDNS issues\n----------\n")
-	if len(pIssues.DNS) > 0 {
-		for _, issue := range pIssues.DNS {
-			if issue.kind == "dns" {
-				fmt.Printf("%v\n", issue.err)
-			}
+	fmt.Fprintf(w, "\nDNS issues\n----------\n")
+	if len(results.DNS) > 0 {
+		for _, issue := range results.DNS {
+			fmt.Fprintf(w, "%s %s\n", formatRating(issue), issue.Error)
 		}
 	} else {
-		fmt.Println(txtNoIssuesFound)
-	}
-	fmt.Printf("\nPotential vulnerabilities\n-------------------------\n")
-	if len(pIssues.potVulns) > 0 {
-		for _, issue := range pIssues.potVulns {
-			if issue.kind == "vuln" {
-				fmt.Printf("%s %v\n", issue.url, issue.err)
-			}
+		fmt.Fprintln(w, txtNoIssuesFound)
+	}
+
+	fmt.Fprintf(w, "\nDangling CNAMEs\n---------------\n")
+	if len(results.DanglingCNAMEs) > 0 {
+		for _, issue := range results.DanglingCNAMEs {
+			fmt.Fprintf(w, "%s %s\n  %s\n", formatRating(issue), issue.Error,
+				formatCNAMEChain(issue.FQDN, issue.CNAMEChain))
 		}
 	} else {
-		fmt.Println(txtNoIssuesFound)
+		fmt.Fprintln(w, txtNoIssuesFound)
+	}
+
+	fmt.Fprintf(w, "\nDangling IPs\n------------\n")
+	if len(results.DanglingIPs) > 0 {
+		for _, issue := range results.DanglingIPs {
+			fmt.Fprintf(w, "%s %s\n", formatRating(issue), issue.Error)
+		}
+	} else {
+		fmt.Fprintln(w, txtNoIssuesFound)
+	}
+
+	fmt.Fprintf(w, "\nMX issues\n---------\n")
+	if len(results.MX) > 0 {
+		for _, issue := range results.MX {
+			fmt.Fprintf(w, "%s %s %s\n", formatRating(issue), issue.FQDN, issue.Error)
+		}
+	} else {
+		fmt.Fprintln(w, txtNoIssuesFound)
+	}
+
+	fmt.Fprintf(w, "\nPotential vulnerabilities\n-------------------------\n")
+	if len(results.Vulnerabilities) > 0 {
+		for _, issue := range results.Vulnerabilities {
+			fmt.Fprintf(w, "%s %s %s\n", formatRating(issue), issueLocation(issue), issue.Error)
+		}
+	} else {
+		fmt.Fprintln(w, txtNoIssuesFound)
+	}
+
+	displaySuppressed(w, results)
+}
+
+// displaySuppressed lists the suppressed issues and the number of issues unchanged since the baseline, if any
+func displaySuppressed(w io.Writer, results Results) {
+	if len(results.Suppressed) > 0 {
+		fmt.Fprintf(w, "\nSuppressed\n----------\n")
+		for _, issue := range results.Suppressed {
+			fmt.Fprintf(w, "%s %s %s (%s)\n", formatRating(issue), issueLocation(issue), issue.Error,
+				issue.SuppressionReason)
+		}
+	}
+	if len(results.Unchanged) > 0 {
+		fmt.Fprintf(w, "\n%d issues unchanged since the baseline were not reported\n", len(results.Unchanged))
 	}
 }
@@ -2,11 +2,17 @@ package subtocheck
 
 import (
 	"bytes"
+	_ "embed"
+	"encoding/csv"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
 
 	"crypto/tls"
 	"os"
@@ -21,13 +27,12 @@ import (
 	"gopkg.in/gomail.v2"
 )
 
-func extractEmail(input string) (output string) {
+// extractEmail returns the address from input, e.g. "Name <name@example.com>", and false if it's malformed
+func extractEmail(input string) (output string, ok bool) {
 	if strings.Contains(input, "<") {
-		output = getStringInBetween(input, "<", ">")
-	} else {
-		output = input
+		return getStringInBetween(input, "<", ">")
 	}
-	return
+	return input, true
 }
 
 func emailConfigDefined(email emailConfig) (result bool) {
@@ -37,85 +42,199 @@ func emailConfigDefined(email emailConfig) (result bool) {
 	return
 }
 
-func validateEmailSettings(email emailConfig) (err error) {
-	supportedProviders := []string{"ses", "smtp"}
-	if emailConfigDefined(email) {
-		if email.Provider == "" {
-			err = fmt.Errorf("email provider not specified")
-			return
-		}
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
 
-		if email.Source == "" {
-			err = fmt.Errorf("email source not specified")
-			return
+// validEmailAddress returns true if input is an address, optionally with a name, e.g. "Name <name@example.com>"
+func validEmailAddress(input string) bool {
+	address, ok := extractEmail(input)
+	return ok && emailRegexp.MatchString(address)
+}
+
+// emailSettingsProblems returns every problem with the email configuration, if defined, including its templates
+func emailSettingsProblems(email emailConfig) (problems []string) {
+	if !emailConfigDefined(email) {
+		return
+	}
+	supportedProviders := []string{"ses", "smtp", "file"}
+	switch {
+	case email.Provider == "":
+		problems = append(problems, "email provider not specified")
+	case !stringInSlice(email.Provider, supportedProviders):
+		problems = append(problems, fmt.Sprintf("email provider '%s' not supported, must be one of: %s",
+			email.Provider, strings.Join(supportedProviders, ", ")))
+	}
+
+	if email.Source == "" {
+		problems = append(problems, "email source not specified")
+	} else if !validEmailAddress(email.Source) {
+		// validate source email address
+		problems = append(problems, fmt.Sprintf("invalid email address '%s'", email.Source))
+	}
+	if len(email.Recipients) == 0 && email.Provider != "file" {
+		problems = append(problems, "email recipients not specified")
+	}
+	// validate recipient email addresses
+	for _, emailAddr := range email.Recipients {
+		if !validEmailAddress(emailAddr) {
+			problems = append(problems, fmt.Sprintf("invalid email address '%s'", emailAddr))
 		}
+	}
 
-		if !stringInSlice(email.Provider, supportedProviders) {
-			err = fmt.Errorf("email provider '%s' not supported", email.Provider)
-			return
+	switch email.Provider {
+	case "ses":
+		// the region is always passed to SES so isn't read from the environment
+		if email.Region == "" {
+			problems = append(problems, "email region not specified")
 		}
-		emailRegexp := regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
-		// validate recipient email addresses
-		for _, emailAddr := range email.Recipients {
-			if !emailRegexp.MatchString(extractEmail(emailAddr)) {
-				err = fmt.Errorf("invalid email address '%s'", extractEmail(emailAddr))
-				return
-			}
+	case "smtp":
+		if email.Host == "" {
+			problems = append(problems, "email host not specified")
 		}
-		// validate source email address
-		if !emailRegexp.MatchString(extractEmail(email.Source)) {
-			err = fmt.Errorf("invalid email address '%s'", extractEmail(email.Source))
-			return
+		if port, err := strconv.Atoi(email.Port); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid email port '%s'", email.Port))
+		}
+	case "file":
+		if email.Directory == "" {
+			problems = append(problems, "email directory not specified")
 		}
 	}
+
+	switch email.AttachmentFormat {
+	case "", "text", "csv", "json":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported attachment format '%s', must be text, csv or json",
+			email.AttachmentFormat))
+	}
+	if _, _, err := parseEmailTemplates(email); err != nil {
+		problems = append(problems, err.Error())
+	}
 	return
 }
 
-func generateDNSIssueList(dnsIssues []issue) (filePath string) {
+func validateEmailSettings(email emailConfig) (err error) {
+	if problems := emailSettingsProblems(email); len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+	}
+	return
+}
+
+// issueAttachment returns the file name and content of an attachment listing the issues as text, csv or json
+func issueAttachment(name string, issues []Issue, format string) (filename string, content []byte, err error) {
 	timeStamp := time.Now().UTC().Format("20060102150405")
-	filePath = fmt.Sprintf("dns_issues_%s.txt", timeStamp)
-	// convert issues to file content
 	var buffer bytes.Buffer
-	for _, dnsIssue := range dnsIssues {
-		buffer.WriteString(dnsIssue.fqdn + " - " + dnsIssue.err.Error() + "\n")
+	switch format {
+	case "", "text":
+		filename = fmt.Sprintf("%s_%s.txt", name, timeStamp)
+		for _, issue := range issues {
+			buffer.WriteString(issueLocation(issue) + " - " + issue.Error + "\n")
+		}
+	case "csv":
+		filename = fmt.Sprintf("%s_%s.csv", name, timeStamp)
+		w := csv.NewWriter(&buffer)
+		_ = w.Write([]string{"kind", "severity", "confidence", "fqdn", "url", "error", "cname_chain", "addresses",
+			"time"})
+		for _, issue := range issues {
+			_ = w.Write([]string{issue.Kind, issue.Severity, issue.Confidence, issue.FQDN, issue.URL, issue.Error,
+				strings.Join(issue.CNAMEChain, " "), strings.Join(issue.Addresses, " "),
+				issue.Time.Format(time.RFC3339)})
+		}
+		w.Flush()
+		if err = w.Error(); err != nil {
+			return "", nil, errors.WithStack(err)
+		}
+	case "json":
+		filename = fmt.Sprintf("%s_%s.json", name, timeStamp)
+		if err = writeJSON(&buffer, issues); err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, errors.Errorf("unsupported attachment format '%s'", format)
+	}
+	return filename, buffer.Bytes(), nil
+}
+
+// attachIssues attaches the list of issues to the message without writing them to disk
+func attachIssues(msg *gomail.Message, name string, issues []Issue, format string) (err error) {
+	filename, content, err := issueAttachment(name, issues, format)
+	if err != nil {
+		return
 	}
-	f, createFileErr := os.Create(filePath)
-	if createFileErr != nil {
-		panic(createFileErr)
+	msg.Attach(filename, gomail.SetCopyFunc(func(w io.Writer) error {
+		_, writeErr := w.Write(content)
+		return writeErr
+	}))
+	return
+}
+
+//go:embed email.html.tmpl
+var defaultHTMLTemplate string
+
+//go:embed email.txt.tmpl
+var defaultTextTemplate string
+
+// emailTemplateFuncs are available to email templates in addition to the built-in functions
+var emailTemplateFuncs = map[string]interface{}{
+	"chain":    formatCNAMEChain,
+	"location": issueLocation,
+	"rating":   formatRating,
+}
+
+// readTemplate returns the content of the template at path or, if path is empty, the default
+func readTemplate(path, defaultTemplate string) (content string, err error) {
+	if path == "" {
+		return defaultTemplate, nil
 	}
-	defer f.Close()
-	_, writeErr := f.Write(buffer.Bytes())
-	if writeErr != nil {
-		panic(writeErr)
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(b), nil
+}
+
+// parseEmailTemplates parses the email's HTML and text templates, using the defaults for those not specified
+func parseEmailTemplates(email emailConfig) (htmlTmpl *htmltemplate.Template, textTmpl *texttemplate.Template,
+	err error) {
+	var content string
+	if content, err = readTemplate(email.HTMLTemplate, defaultHTMLTemplate); err != nil {
+		return
+	}
+	if htmlTmpl, err = htmltemplate.New("html").Funcs(emailTemplateFuncs).Parse(content); err != nil {
+		err = errors.Wrap(err, "invalid HTML template")
+		return
+	}
+	if content, err = readTemplate(email.TextTemplate, defaultTextTemplate); err != nil {
+		return
+	}
+	if textTmpl, err = texttemplate.New("text").Funcs(emailTemplateFuncs).Parse(content); err != nil {
+		err = errors.Wrap(err, "invalid text template")
 	}
-	f.Sync()
 	return
 }
 
-func generateRequestIssueList(requestIssues []issue) (filePath string) {
-	timeStamp := time.Now().UTC().Format("20060102150405")
-	filePath = fmt.Sprintf("request_issues_%s.txt", timeStamp)
-	// convert issues to file content
-	var buffer bytes.Buffer
-	for _, requestIssue := range requestIssues {
-		buffer.WriteString(requestIssue.url + " - " + requestIssue.err.Error() + "\n")
+// renderEmail returns the HTML and plain text bodies of the email for the results
+func renderEmail(email emailConfig, results Results) (htmlBody, textBody string, err error) {
+	htmlTmpl, textTmpl, err := parseEmailTemplates(email)
+	if err != nil {
+		return
 	}
-	f, createFileErr := os.Create(filePath)
-	if createFileErr != nil {
-		panic(createFileErr)
+	var buf bytes.Buffer
+	if err = htmlTmpl.Execute(&buf, results); err != nil {
+		return "", "", errors.Wrap(err, "failed to render HTML template")
 	}
-	defer f.Close()
-	_, writeErr := f.Write(buffer.Bytes())
-	if writeErr != nil {
-		panic(writeErr)
+	htmlBody = buf.String()
+	buf.Reset()
+	if err = textTmpl.Execute(&buf, results); err != nil {
+		return "", "", errors.Wrap(err, "failed to render text template")
 	}
-	f.Sync()
+	textBody = buf.String()
 	return
 }
 
-func emailResults(email emailConfig, pIssues processedIssues) (err error) {
-	msg := gomail.NewMessage()
+// buildEmail returns the message reporting the results, with its bodies and attachments
+func buildEmail(email emailConfig, results Results) (msg *gomail.Message, err error) {
+	msg = gomail.NewMessage()
 	msg.SetHeader("From", email.Source)
+	msg.SetHeader("To", email.Recipients...)
 	var emailSubject string
 	if email.Subject != "" {
 		emailSubject = email.Subject
@@ -123,102 +242,96 @@ func emailResults(email emailConfig, pIssues processedIssues) (err error) {
 		emailSubject = "AWS Account Scan"
 	}
 
-	if len(pIssues.potVulns) > 0 {
+	if results.hasTakeovers() {
 		emailSubject += " - potential vulnerabilities found"
 	} else {
 		emailSubject += " - no potential vulnerabilities found"
 	}
 	msg.SetHeader("Subject", emailSubject)
 
-	body := "<font face=\"Courier New, Courier, monospace\">" +
-		"&nbsp;Issues<br/>" +
-		"--------" +
-		"<br/>" +
-		"</font>" +
-		"<table border=\"0\" cellpadding=\"3\" cellspacing=\"3\" width=\"300\">" +
-		"<tr>" +
-		"<td><font face=\"Courier New, Courier, monospace\">Potentially vulnerable</font></td>" +
-		"<td><font face=\"Courier New, Courier, monospace\">&nbsp;" + strconv.Itoa(len(pIssues.potVulns)) + "</font></td>" +
-		"</tr>" +
-		"<tr>" +
-		"<td><font face=\"Courier New, Courier, monospace\">DNS</font></td>" +
-		"<td><font face=\"Courier New, Courier, monospace\">&nbsp;" + strconv.Itoa(len(pIssues.DNS)) + "</font></td>" +
-		"</tr>" +
-		"<tr>" +
-		"<td><font face=\"Courier New, Courier, monospace\">Request</font></td>" +
-		"<td><font face=\"Courier New, Courier, monospace\">&nbsp;" + strconv.Itoa(len(pIssues.request)) + "</font></td>" +
-		"</tr>" +
-		"</table>" +
-		"<br/><font face=\"Courier New, Courier, monospace\">" +
-		"&nbsp;Potentially vulnerable URLs<br/>" +
-		"-----------------------------" +
-		"<br/>" +
-		"</font>" +
-		"<table border=\"0\" cellpadding=\"3\" cellspacing=\"4\" width=\"300\">"
-
-	if len(pIssues.potVulns) > 0 {
-		for _, vuln := range pIssues.potVulns {
-			body += "<tr><td width=\"300\"><font face=\"Courier New, Courier, monospace\">" + vuln.url + " (" + vuln.platform + ")</font></td></tr>"
-		}
-	} else {
-		body += "<tr><td width=\"300\"><font face=\"Courier New, Courier, monospace\">none found</font></td></tr>"
+	var htmlBody, textBody string
+	if htmlBody, textBody, err = renderEmail(email, results); err != nil {
+		return
 	}
-	// close table
-	body = body + "</table>"
-	msg.SetBody("text/html", body)
+	msg.SetBody("text/plain", textBody)
+	msg.AddAlternative("text/html", htmlBody)
 
-	var dnsIssuesFilePath, requestIssuesFilePath string
-	if len(pIssues.DNS) > 0 {
-		// generate DNS issues file to attach
-		dnsIssuesFilePath = generateDNSIssueList(pIssues.DNS)
-		msg.Attach(dnsIssuesFilePath)
+	if len(results.DNS) > 0 {
+		if err = attachIssues(msg, "dns_issues", results.DNS, email.AttachmentFormat); err != nil {
+			return
+		}
 	}
-
-	if len(pIssues.request) > 0 {
-		// generate requests issues file to attach
-		requestIssuesFilePath = generateRequestIssueList(pIssues.request)
-		msg.Attach(requestIssuesFilePath)
+	if len(results.Request) > 0 {
+		if err = attachIssues(msg, "request_issues", results.Request, email.AttachmentFormat); err != nil {
+			return
+		}
 	}
+	return
+}
 
-	var emailRaw bytes.Buffer
-	_, err = msg.WriteTo(&emailRaw)
+// rawEmail returns the RFC 5322 message reporting the results
+func rawEmail(email emailConfig, results Results) (raw []byte, err error) {
+	msg, err := buildEmail(email, results)
 	if err != nil {
-		err = errors.WithStack(err)
 		return
 	}
+	var emailRaw bytes.Buffer
+	if _, err = msg.WriteTo(&emailRaw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return emailRaw.Bytes(), nil
+}
 
+// writeFile writes content to a new file in dir, creating dir if required, named with the prefix, the current
+// time and ext
+func writeFile(dir, prefix, ext string, content []byte) (path string, err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.WithStack(err)
+	}
+	var f *os.File
+	if f, err = os.CreateTemp(dir, prefix+"_"+time.Now().UTC().Format("20060102150405")+"_*."+ext); err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(content); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return f.Name(), nil
+}
+
+func emailResults(email emailConfig, results Results) (err error) {
 	switch email.Provider {
 	case "ses":
 		var sess *session.Session
 		var staticCreds *credentials.Credentials
-		if email.Provider == "ses" {
-			if email.AWSAccessKeyID != "" && email.AWSSecretAccessKey != "" && email.AWSSessionToken != "" {
-				// try getting with id, secret, and session
-				staticCreds = credentials.NewStaticCredentials(email.AWSAccessKeyID,
-					email.AWSSecretAccessKey, email.AWSSessionToken)
-				sess, err = session.NewSession(&aws.Config{Credentials: staticCreds})
-			} else if email.AWSAccessKeyID != "" && email.AWSSecretAccessKey != "" {
-				//try with id and secret only
-				staticCreds = credentials.NewStaticCredentials(email.AWSAccessKeyID,
-					email.AWSSecretAccessKey, "")
-				sess, err = session.NewSession(&aws.Config{Credentials: staticCreds})
-			} else {
-				// try discovering credentials
-				sess, err = session.NewSession()
-			}
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			err = validateEmailSettings(email)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
+		if email.AWSAccessKeyID != "" && email.AWSSecretAccessKey != "" && email.AWSSessionToken != "" {
+			// try getting with id, secret, and session
+			staticCreds = credentials.NewStaticCredentials(email.AWSAccessKeyID,
+				email.AWSSecretAccessKey, email.AWSSessionToken)
+			sess, err = session.NewSession(&aws.Config{Credentials: staticCreds})
+		} else if email.AWSAccessKeyID != "" && email.AWSSecretAccessKey != "" {
+			//try with id and secret only
+			staticCreds = credentials.NewStaticCredentials(email.AWSAccessKeyID,
+				email.AWSSecretAccessKey, "")
+			sess, err = session.NewSession(&aws.Config{Credentials: staticCreds})
+		} else {
+			// try discovering credentials
+			sess, err = session.NewSession()
+		}
+		if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		err = validateEmailSettings(email)
+		if err != nil {
+			return
+		}
+		var raw []byte
+		if raw, err = rawEmail(email, results); err != nil {
+			return
 		}
-		msg.SetHeader("To", strings.Join(email.Recipients, ","))
 		svc := ses.New(sess, &aws.Config{Region: PtrToStr(email.Region)})
-		message := ses.RawMessage{Data: emailRaw.Bytes()}
+		message := ses.RawMessage{Data: raw}
 		source := aws.String(email.Source)
 		var destinations []*string
 		for _, dest := range email.Recipients {
@@ -227,10 +340,16 @@ func emailResults(email emailConfig, pIssues processedIssues) (err error) {
 		input := ses.SendRawEmailInput{Source: source, Destinations: destinations, RawMessage: &message}
 		_, err = svc.SendRawEmail(&input)
 		if err != nil {
-			panic(err)
+			err = errors.WithStack(err)
 		}
 	case "smtp":
-		msg.SetHeader("To", email.Recipients...)
+		if err = validateEmailSettings(email); err != nil {
+			return
+		}
+		var msg *gomail.Message
+		if msg, err = buildEmail(email, results); err != nil {
+			return
+		}
 		host := email.Host
 		port, _ := strconv.Atoi(email.Port)
 		dialer := gomail.NewPlainDialer(host, port, email.Username, email.Password)
@@ -241,24 +360,20 @@ func emailResults(email emailConfig, pIssues processedIssues) (err error) {
 		dialer.TLSConfig = tlsConfig
 		err = dialer.DialAndSend(msg)
 		if err != nil {
-			cleanUpFiles(dnsIssuesFilePath, requestIssuesFilePath)
-			panic(err)
+			err = errors.WithStack(err)
 		}
-	}
-	return
-}
-
-func cleanUpFiles(dnsIssuesFilePath string, requestIssuesFilePath string) {
-	if dnsIssuesFilePath != "" {
-		delDNSErr := os.Remove(dnsIssuesFilePath)
-		if delDNSErr != nil {
-			fmt.Println(delDNSErr)
+	case "file":
+		// write the message instead of sending it, e.g. to review it
+		if err = validateEmailSettings(email); err != nil {
+			return
 		}
-	}
-	if requestIssuesFilePath != "" {
-		delReqErr := os.Remove(requestIssuesFilePath)
-		if delReqErr != nil {
-			fmt.Println(delReqErr)
+		var raw []byte
+		if raw, err = rawEmail(email, results); err != nil {
+			return
 		}
+		_, err = writeFile(email.Directory, "subtocheck", "eml", raw)
+	default:
+		err = errors.Errorf("email provider '%s' not supported", email.Provider)
 	}
+	return
 }
@@ -0,0 +1,116 @@
+package subtocheck
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/gomail.v2"
+)
+
+func TestRenderEmail(t *testing.T) {
+	results := getIssuesSummary(issues{
+		{Kind: "vuln", FQDN: "shop.example.com", URL: "http://shop.example.com/<script>", Platform: "Heroku",
+			Severity: "high", Confidence: "likely", CNAMEChain: []string{"shop.herokuapp.com"}, StatusCode: 404,
+			Error: "matches pattern for platform: Heroku"},
+		{Kind: "dangling", FQDN: "old.example.com", CNAMEChain: []string{"old.example.net"},
+			Error: "old.example.com is a dangling CNAME"},
+	})
+	htmlBody, textBody, err := renderEmail(emailConfig{}, results)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if strings.Contains(htmlBody, "<script>") || !strings.Contains(htmlBody, "&lt;script&gt;") {
+		t.Errorf("expected URL to be escaped:\n%s", htmlBody)
+	}
+	for _, body := range []string{htmlBody, textBody} {
+		for _, expected := range []string{"shop.example.com -&gt; shop.herokuapp.com", "Status code: 404",
+			"Platform: Heroku", "old.example.com -&gt; old.example.net"} {
+			if body == textBody {
+				expected = strings.ReplaceAll(expected, "&gt;", ">")
+			}
+			if !strings.Contains(body, expected) {
+				t.Errorf("expected body to contain %q:\n%s", expected, body)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "email.txt")
+	if err = os.WriteFile(path, []byte("{{len .Vulnerabilities}} vulnerable"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, textBody, err = renderEmail(emailConfig{TextTemplate: path}, results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if textBody != "1 vulnerable" {
+		t.Errorf("unexpected text from custom template: %s", textBody)
+	}
+}
+
+func TestIssueAttachment(t *testing.T) {
+	dnsIssues := []Issue{{Kind: "dns", FQDN: "old.example.com",
+		Error: "old.example.com could not be resolved, \"timeout\""}}
+	for format, expected := range map[string]string{
+		"":     "old.example.com - old.example.com could not be resolved",
+		"csv":  `dns,,,old.example.com,,"old.example.com could not be resolved, ""timeout"""`,
+		"json": `"fqdn": "old.example.com"`,
+	} {
+		filename, content, err := issueAttachment("dns_issues", dnsIssues, format)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if !strings.HasPrefix(filename, "dns_issues_") || !strings.Contains(string(content), expected) {
+			t.Errorf("%s: unexpected attachment %s:\n%s", format, filename, content)
+		}
+	}
+	if _, _, err := issueAttachment("dns_issues", dnsIssues, "xml"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+
+	msg := gomail.NewMessage()
+	if err := attachIssues(msg, "dns_issues", dnsIssues, "csv"); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(raw.String(), `filename="dns_issues_`) {
+		t.Errorf("expected attachment in message:\n%s", raw.String())
+	}
+	if matches, _ := filepath.Glob("dns_issues_*"); len(matches) > 0 {
+		t.Errorf("attachments should not be written to disk: %v", matches)
+	}
+}
+
+func TestEmailResultsFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	email := emailConfig{Provider: "file", Directory: dir, Subject: "subtocheck", Source: "from@example.com",
+		Recipients: []string{"to@example.com"}}
+	results := getIssuesSummary(issues{{Kind: "dns", FQDN: "old.example.com",
+		Error: "old.example.com could not be resolved"}})
+	if err := emailResults(email, results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(paths) != 1 {
+		t.Fatalf("expected one email to be written, got: %v", paths)
+	}
+	raw, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"To: to@example.com", "Subject: subtocheck - no potential vulnerabilities found",
+		"multipart/mixed", "text/html", `filename="dns_issues_`} {
+		if !strings.Contains(string(raw), expected) {
+			t.Errorf("expected email to contain %q:\n%s", expected, raw)
+		}
+	}
+
+	email.Directory = ""
+	if err = emailResults(email, results); err == nil {
+		t.Error("expected error without a directory")
+	}
+}
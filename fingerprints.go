@@ -0,0 +1,324 @@
+package subtocheck
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed fingerprints.yaml
+var defaultFingerprints []byte
+
+// Fingerprint identifies a platform that a domain may be taken over on
+type Fingerprint struct {
+	Platform           string          `yaml:"platform" json:"platform"`
+	Severity           string          `yaml:"severity" json:"severity"`           // default high
+	Confidence         string          `yaml:"confidence" json:"confidence"`       // default likely
+	ResponseCodes      []int           `yaml:"responseCodes" json:"responseCodes"` // empty for all
+	BodyStrings        []string        `yaml:"bodyStrings" json:"bodyStrings"`
+	BodyRegex          []string        `yaml:"bodyRegex" json:"bodyRegex"`
+	BodyStringMatch    string          `yaml:"bodyStringMatch" json:"bodyStringMatch"` // all (default) or any
+	Headers            []HeaderMatcher `yaml:"headers" json:"headers"`                 // all must match
+	ExcludeBodyStrings []string        `yaml:"excludeBodyStrings" json:"excludeBodyStrings"`
+	ExcludeBodyRegex   []string        `yaml:"excludeBodyRegex" json:"excludeBodyRegex"`
+	ExcludeHeaders     []HeaderMatcher `yaml:"excludeHeaders" json:"excludeHeaders"`
+	CNAMEs             []string        `yaml:"cnames" json:"cnames"` // domain suffixes
+	CNAMERegex         []string        `yaml:"cnameRegex" json:"cnameRegex"`
+	NXDomain           bool            `yaml:"nxdomain" json:"nxdomain"`       // match on the CNAME target not existing
+	Nameservers        []string        `yaml:"nameservers" json:"nameservers"` // suffixes of lame delegated nameservers
+	NameserverRegex    []string        `yaml:"nameserverRegex" json:"nameserverRegex"`
+	MX                 []string        `yaml:"mx" json:"mx"` // domain suffixes of MX hosts
+	MXRegex            []string        `yaml:"mxRegex" json:"mxRegex"`
+	bodyRegexps        []*regexp.Regexp
+	excludeBodyRegexps []*regexp.Regexp
+	cnameRegexps       []*regexp.Regexp
+	nsRegexps          []*regexp.Regexp
+	mxRegexps          []*regexp.Regexp
+}
+
+// HeaderMatcher matches a response header by name and, optionally, its value
+type HeaderMatcher struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"` // substring of the value, empty to match any value
+	Regex string `yaml:"regex" json:"regex"`
+	re    *regexp.Regexp
+}
+
+// matches returns true if any of the values of the named header match
+func (matcher HeaderMatcher) matches(header http.Header) bool {
+	for _, value := range header.Values(matcher.Name) {
+		if strings.Contains(value, matcher.Value) && (matcher.re == nil || matcher.re.MatchString(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesResponse returns true if the response matches the fingerprint's response codes, headers and body
+// matchers, and none of its exclusions
+func (pattern Fingerprint) matchesResponse(statusCode int, header http.Header, body string) bool {
+	if len(pattern.ResponseCodes) > 0 && !contains(pattern.ResponseCodes, statusCode) {
+		return false
+	}
+	for _, matcher := range pattern.Headers {
+		if !matcher.matches(header) {
+			return false
+		}
+	}
+	for _, matcher := range pattern.ExcludeHeaders {
+		if matcher.matches(header) {
+			return false
+		}
+	}
+	for _, excluded := range pattern.ExcludeBodyStrings {
+		if strings.Contains(body, excluded) {
+			return false
+		}
+	}
+	for _, re := range pattern.excludeBodyRegexps {
+		if re.MatchString(body) {
+			return false
+		}
+	}
+	if len(pattern.BodyStrings) == 0 && len(pattern.bodyRegexps) == 0 {
+		return true
+	}
+	var matched int
+	for _, bodyString := range pattern.BodyStrings {
+		if strings.Contains(body, bodyString) {
+			matched++
+		}
+	}
+	for _, re := range pattern.bodyRegexps {
+		if re.MatchString(body) {
+			matched++
+		}
+	}
+	if pattern.BodyStringMatch == "any" {
+		return matched > 0
+	}
+	return matched == len(pattern.BodyStrings)+len(pattern.bodyRegexps)
+}
+
+// requiresCNAME returns true if the fingerprint only applies to names with a matching CNAME
+func (pattern Fingerprint) requiresCNAME() bool {
+	return len(pattern.CNAMEs) > 0 || len(pattern.cnameRegexps) > 0
+}
+
+// checksResponse returns true if the fingerprint is matched against HTTP responses
+func (pattern Fingerprint) checksResponse() bool {
+	return !pattern.NXDomain && !pattern.checksNameservers() && !pattern.checksMX()
+}
+
+// checksMX returns true if the fingerprint is matched against MX hosts
+func (pattern Fingerprint) checksMX() bool {
+	return len(pattern.MX) > 0 || len(pattern.MXRegex) > 0
+}
+
+// checksNameservers returns true if the fingerprint is matched against lame delegated nameservers
+func (pattern Fingerprint) checksNameservers() bool {
+	return len(pattern.Nameservers) > 0 || len(pattern.NameserverRegex) > 0
+}
+
+// matchesCNAME returns true if any hop in the CNAME chain matches one of the fingerprint's suffixes or expressions
+func (pattern Fingerprint) matchesCNAME(chain []string) bool {
+	return matchesDomain(chain, pattern.CNAMEs, pattern.cnameRegexps)
+}
+
+// matchesNameserver returns true if the nameserver matches one of the fingerprint's suffixes or expressions
+func (pattern Fingerprint) matchesNameserver(nameserver string) bool {
+	return matchesDomain([]string{nameserver}, pattern.Nameservers, pattern.nsRegexps)
+}
+
+// matchesMX returns true if the MX host, or any hop in its CNAME chain, matches one of the fingerprint's suffixes
+// or expressions
+func (pattern Fingerprint) matchesMX(host string, chain []string) bool {
+	return matchesDomain(append([]string{host}, chain...), pattern.MX, pattern.mxRegexps)
+}
+
+// matchesDomain returns true if any of the names is, or is a subdomain of, one of the suffixes or matches one of
+// the regular expressions
+func matchesDomain(names []string, suffixes []string, regexps []*regexp.Regexp) bool {
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		for _, suffix := range suffixes {
+			suffix = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(suffix, "*"), "."))
+			if name == suffix || strings.HasSuffix(name, "."+suffix) {
+				return true
+			}
+		}
+		for _, re := range regexps {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compileRegexps(exprs []string) (regexps []*regexp.Regexp, err error) {
+	for _, expr := range exprs {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(expr); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		regexps = append(regexps, re)
+	}
+	return
+}
+
+// DefaultFingerprints returns the built-in fingerprints
+func DefaultFingerprints() ([]Fingerprint, error) {
+	return parseFingerprints(defaultFingerprints, false)
+}
+
+// LoadFingerprints returns the fingerprints defined in the YAML or JSON file at path
+func LoadFingerprints(path string) (patterns []Fingerprint, err error) {
+	var content []byte
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	return parseFingerprints(content, strings.EqualFold(filepath.Ext(path), ".json"))
+}
+
+func parseFingerprints(content []byte, isJSON bool) (patterns []Fingerprint, err error) {
+	if isJSON {
+		// unknown fields are errors, as with YAML, so that misspelt fields aren't silently ignored
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&patterns)
+	} else {
+		err = yaml.UnmarshalStrict(content, &patterns)
+	}
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if len(patterns) == 0 {
+		err = errors.New("no fingerprints defined")
+		return
+	}
+	for i := range patterns {
+		if err = validateFingerprint(&patterns[i]); err != nil {
+			err = errors.Wrapf(err, "fingerprint %d", i+1)
+			return
+		}
+	}
+	return
+}
+
+func validateFingerprint(pattern *Fingerprint) (err error) {
+	if pattern.Platform == "" {
+		return errors.New("platform not specified")
+	}
+	for _, code := range pattern.ResponseCodes {
+		if code < 100 || code > 599 {
+			return errors.Errorf("%s: invalid response code %d", pattern.Platform, code)
+		}
+	}
+	matchesBody := len(pattern.BodyStrings) > 0 || len(pattern.BodyRegex) > 0
+	matchesResponse := len(pattern.ResponseCodes) > 0 || matchesBody || pattern.BodyStringMatch != "" ||
+		len(pattern.Headers) > 0 || len(pattern.ExcludeBodyStrings) > 0 || len(pattern.ExcludeBodyRegex) > 0 ||
+		len(pattern.ExcludeHeaders) > 0
+	matchesCNAMEs := len(pattern.CNAMEs) > 0 || len(pattern.CNAMERegex) > 0
+	if pattern.checksNameservers() {
+		if matchesResponse || pattern.NXDomain || matchesCNAMEs || pattern.checksMX() {
+			return errors.Errorf("%s: nameserver fingerprints cannot match on anything else", pattern.Platform)
+		}
+	} else if pattern.checksMX() {
+		if matchesResponse || matchesCNAMEs {
+			return errors.Errorf("%s: mx fingerprints cannot match on CNAMEs or responses", pattern.Platform)
+		}
+	} else if pattern.NXDomain {
+		if len(pattern.CNAMEs) == 0 && len(pattern.CNAMERegex) == 0 {
+			return errors.Errorf("%s: nxdomain fingerprints require cnames or cnameRegex", pattern.Platform)
+		}
+		if matchesResponse {
+			return errors.Errorf("%s: nxdomain fingerprints cannot match on responses", pattern.Platform)
+		}
+	} else if !matchesBody && len(pattern.Headers) == 0 {
+		return errors.Errorf("%s: no bodyStrings, bodyRegex or headers specified", pattern.Platform)
+	}
+	for _, bodyString := range append(append([]string{}, pattern.BodyStrings...), pattern.ExcludeBodyStrings...) {
+		if bodyString == "" {
+			return errors.Errorf("%s: bodyStrings must not be empty", pattern.Platform)
+		}
+	}
+	for _, matchers := range [][]HeaderMatcher{pattern.Headers, pattern.ExcludeHeaders} {
+		for i := range matchers {
+			if matchers[i].Name == "" {
+				return errors.Errorf("%s: header name not specified", pattern.Platform)
+			}
+			if matchers[i].Regex == "" {
+				continue
+			}
+			if matchers[i].re, err = regexp.Compile(matchers[i].Regex); err != nil {
+				return errors.Wrapf(errors.WithStack(err), "%s: invalid regex for header %s", pattern.Platform,
+					matchers[i].Name)
+			}
+		}
+	}
+	if pattern.bodyRegexps, err = compileRegexps(pattern.BodyRegex); err != nil {
+		return errors.Wrapf(err, "%s: invalid bodyRegex", pattern.Platform)
+	}
+	if pattern.excludeBodyRegexps, err = compileRegexps(pattern.ExcludeBodyRegex); err != nil {
+		return errors.Wrapf(err, "%s: invalid excludeBodyRegex", pattern.Platform)
+	}
+	for _, suffix := range pattern.CNAMEs {
+		if strings.Trim(suffix, "*.") == "" {
+			return errors.Errorf("%s: cnames must not be empty", pattern.Platform)
+		}
+	}
+	for _, suffix := range pattern.Nameservers {
+		if strings.Trim(suffix, "*.") == "" {
+			return errors.Errorf("%s: nameservers must not be empty", pattern.Platform)
+		}
+	}
+	for _, suffix := range pattern.MX {
+		if strings.Trim(suffix, "*.") == "" {
+			return errors.Errorf("%s: mx must not be empty", pattern.Platform)
+		}
+	}
+	if pattern.cnameRegexps, err = compileRegexps(pattern.CNAMERegex); err != nil {
+		return errors.Wrapf(err, "%s: invalid cnameRegex", pattern.Platform)
+	}
+	if pattern.nsRegexps, err = compileRegexps(pattern.NameserverRegex); err != nil {
+		return errors.Wrapf(err, "%s: invalid nameserverRegex", pattern.Platform)
+	}
+	if pattern.mxRegexps, err = compileRegexps(pattern.MXRegex); err != nil {
+		return errors.Wrapf(err, "%s: invalid mxRegex", pattern.Platform)
+	}
+	if pattern.Severity == "" {
+		pattern.Severity = defaultRatings["vuln"].severity
+	}
+	if err = ValidateSeverity(pattern.Severity); err != nil {
+		return errors.Wrap(err, pattern.Platform)
+	}
+	if pattern.Confidence == "" {
+		pattern.Confidence = defaultRatings["vuln"].confidence
+	}
+	if err = validateConfidence(pattern.Confidence); err != nil {
+		return errors.Wrap(err, pattern.Platform)
+	}
+	switch pattern.BodyStringMatch {
+	case "":
+		if pattern.checksResponse() {
+			pattern.BodyStringMatch = "all"
+		}
+	case "all", "any":
+	default:
+		return errors.Errorf("%s: bodyStringMatch '%s' must be 'all' or 'any'", pattern.Platform,
+			pattern.BodyStringMatch)
+	}
+	return
+}
@@ -0,0 +1,131 @@
+package subtocheck
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoadDefaultFingerprints(t *testing.T) {
+	patterns, err := DefaultFingerprints()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(patterns) == 0 {
+		t.Fatal("expected built-in fingerprints")
+	}
+	for _, pattern := range patterns {
+		if !pattern.checksResponse() {
+			continue
+		}
+		if pattern.BodyStringMatch != "all" && pattern.BodyStringMatch != "any" {
+			t.Errorf("%s: unexpected bodyStringMatch '%s'", pattern.Platform, pattern.BodyStringMatch)
+		}
+	}
+}
+
+func TestParseFingerprints(t *testing.T) {
+	patterns, err := parseFingerprints([]byte(`[{"platform": "Internal PaaS", "responseCodes": [404],
+		"bodyStrings": ["no such app"]}]`), true)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(patterns) != 1 || patterns[0].BodyStringMatch != "all" || patterns[0].Severity != "high" ||
+		patterns[0].Confidence != "likely" {
+		t.Errorf("unexpected fingerprints: %+v", patterns)
+	}
+
+	invalid := []string{
+		"- platform: Example\n  bodyStrings: [\"x\"]\n  bodyStringMatch: some\n",
+		"- platform: Example\n  responseCodes: [42]\n  bodyStrings: [\"x\"]\n",
+		"- platform: Example\n",
+		"- bodyStrings: [\"x\"]\n",
+		"- platform: Example\n  bodyString: [\"x\"]\n",
+		"- platform: Example\n  nxdomain: true\n",
+		"- platform: Example\n  cnames: [\"example.net\"]\n  bodyStrings: [\"x\"]\n  nxdomain: true\n",
+		"- platform: Example\n  bodyRegex: [\"(\"]\n",
+		"- platform: Example\n  headers: [{value: \"x\"}]\n",
+		"- platform: Example\n  headers: [{name: Server, regex: \"(\"}]\n",
+		"- platform: Example\n  excludeBodyStrings: [\"x\"]\n",
+		"- platform: Example\n  bodyStrings: [\"x\"]\n  severity: urgent\n",
+		"- platform: Example\n  bodyStrings: [\"x\"]\n  confidence: certain\n",
+	}
+	for _, content := range invalid {
+		if _, err = parseFingerprints([]byte(content), false); err == nil {
+			t.Errorf("expected error parsing:\n%s", content)
+		}
+	}
+	if _, err = parseFingerprints([]byte(`[{"platform": "Example", "bodyStrings": ["x"], "bodyStringMatc": "any"}]`),
+		true); err == nil {
+		t.Error("expected error for unknown JSON field")
+	}
+}
+
+func TestFingerprintMatchesCNAME(t *testing.T) {
+	patterns, err := parseFingerprints([]byte(`
+- platform: Example
+  bodyStrings: ["x"]
+  cnames: ["*.example-paas.com"]
+  cnameRegex: ['^[a-z]+\.s3-website[.-][a-z0-9-]+\.amazonaws\.com$']
+`), false)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	pattern := patterns[0]
+	if !pattern.requiresCNAME() {
+		t.Error("expected fingerprint to require a CNAME")
+	}
+	for _, chain := range [][]string{
+		{"app.example-paas.com"},
+		{"cdn.example.net", "APP.Example-PaaS.com."},
+		{"bucket.s3-website-eu-west-1.amazonaws.com"},
+	} {
+		if !pattern.matchesCNAME(chain) {
+			t.Errorf("expected %v to match", chain)
+		}
+	}
+	for _, chain := range [][]string{nil, {"example-paas.com.evil.net"}, {"notexample-paas.com"}} {
+		if pattern.matchesCNAME(chain) {
+			t.Errorf("expected %v not to match", chain)
+		}
+	}
+}
+
+func TestFingerprintMatchesResponse(t *testing.T) {
+	patterns, err := parseFingerprints([]byte(`
+- platform: Example
+  bodyStrings: ["NoSuchBucket"]
+  bodyRegex: ['bucket [a-z0-9.-]+ does not exist']
+  headers:
+    - name: server
+      value: AmazonS3
+    - name: X-Amz-Error-Code
+  excludeBodyStrings: ["BucketName: www.example.com"]
+  excludeHeaders:
+    - name: X-Cache
+      regex: '^Hit'
+`), false)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	pattern := patterns[0]
+	body := "NoSuchBucket: bucket assets.example.com does not exist"
+	header := http.Header{"Server": {"AmazonS3"}, "X-Amz-Error-Code": {"NoSuchBucket"}}
+	if !pattern.matchesResponse(http.StatusNotFound, header, body) {
+		t.Error("expected response to match")
+	}
+	for name, header := range map[string]http.Header{
+		"missing header": {"Server": {"AmazonS3"}},
+		"header value":   {"Server": {"nginx"}, "X-Amz-Error-Code": {"NoSuchBucket"}},
+		"excluded header": {"Server": {"AmazonS3"}, "X-Amz-Error-Code": {"NoSuchBucket"},
+			"X-Cache": {"Hit from cloudfront"}},
+	} {
+		if pattern.matchesResponse(http.StatusNotFound, header, body) {
+			t.Errorf("%s: expected response not to match", name)
+		}
+	}
+	for _, body := range []string{"NoSuchBucket", body + "\nBucketName: www.example.com"} {
+		if pattern.matchesResponse(http.StatusNotFound, header, body) {
+			t.Errorf("expected body not to match: %s", body)
+		}
+	}
+}
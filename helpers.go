@@ -57,14 +57,19 @@ func contains(s []int, e int) bool {
 	return false
 }
 
-func getStringInBetween(str string, start string, end string) (result string) {
+// getStringInBetween returns the text between the first start marker and the end marker following it, and false if
+// either is missing
+func getStringInBetween(str string, start string, end string) (result string, ok bool) {
 	s := strings.Index(str, start)
 	if s == -1 {
 		return
 	}
 	s += len(start)
-	e := strings.Index(str, end)
-	return str[s:e]
+	e := strings.Index(str[s:], end)
+	if e == -1 {
+		return
+	}
+	return str[s : s+e], true
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -76,6 +81,16 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
+// nonEmpty returns the strings that aren't empty
+func nonEmpty(strs ...string) (result []string) {
+	for _, str := range strs {
+		if str != "" {
+			result = append(result, str)
+		}
+	}
+	return
+}
+
 // PtrToStr returns a pointer to an existing string
 func PtrToStr(s string) *string {
 	return &s
@@ -0,0 +1,207 @@
+package subtocheck
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotTimeFormat names snapshots so that sorting them by name sorts them by when the run started
+const snapshotTimeFormat = "20060102T150405.000Z"
+
+// SaveSnapshot writes the results to a new JSON file in the state directory, creating it if required, and returns
+// the file's path
+func SaveSnapshot(stateDir string, results Results) (path string, err error) {
+	if err = os.MkdirAll(stateDir, 0o755); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	path = filepath.Join(stateDir, results.Started.UTC().Format(snapshotTimeFormat)+".json")
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	defer f.Close()
+	err = writeJSON(f, results)
+	return
+}
+
+// Snapshots returns the paths of the snapshots in the state directory, oldest first
+func Snapshots(stateDir string) (paths []string, err error) {
+	if paths, err = filepath.Glob(filepath.Join(stateDir, "*.json")); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	sort.Strings(paths)
+	return
+}
+
+// Change is an issue whose platform differs between two runs
+type Change struct {
+	Before Issue `json:"before"`
+	After  Issue `json:"after"`
+}
+
+// RunDiff lists the issues that appeared, disappeared or changed platform between two runs
+type RunDiff struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Appeared    []Issue   `json:"appeared"`
+	Disappeared []Issue   `json:"disappeared"`
+	Changed     []Change  `json:"changed"`
+}
+
+// diffKey identifies an issue between runs regardless of the platform it matched
+func diffKey(issue Issue) string {
+	return strings.Join([]string{issue.Kind, issue.FQDN, issue.URL, issue.MXHost}, "|")
+}
+
+// groupByDiffKey returns the issues keyed by diffKey. Where several fingerprints matched the same URL, a single
+// issue is kept with their platforms combined. Suppressed and unchanged issues are included, as suppressing an issue
+// or excluding it with a baseline doesn't mean it has been fixed.
+func groupByDiffKey(results Results) (keys []string, grouped map[string]Issue) {
+	// issues unchanged since a baseline are still present, as are suppressed issues
+	all := append(append([]Issue(nil), results.Suppressed...), results.Unchanged...)
+	for _, group := range results.byKind() {
+		all = append(all, group...)
+	}
+	// combine platforms in the same order however the issues were grouped
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Platform < all[j].Platform
+	})
+	grouped = make(map[string]Issue)
+	for _, issue := range all {
+		key := diffKey(issue)
+		if existing, ok := grouped[key]; ok {
+			existing.Platform += ", " + issue.Platform
+			grouped[key] = existing
+			continue
+		}
+		keys = append(keys, key)
+		grouped[key] = issue
+	}
+	sort.Strings(keys)
+	return
+}
+
+// diffResults compares the issues found by two runs
+func diffResults(from, to Results) (diff RunDiff) {
+	diff.From, diff.To = from.Started, to.Started
+	fromKeys, fromIssues := groupByDiffKey(from)
+	toKeys, toIssues := groupByDiffKey(to)
+	for _, key := range toKeys {
+		before, ok := fromIssues[key]
+		switch {
+		case !ok:
+			diff.Appeared = append(diff.Appeared, toIssues[key])
+		case before.Platform != toIssues[key].Platform:
+			diff.Changed = append(diff.Changed, Change{Before: before, After: toIssues[key]})
+		}
+	}
+	for _, key := range fromKeys {
+		if _, ok := toIssues[key]; !ok {
+			diff.Disappeared = append(diff.Disappeared, fromIssues[key])
+		}
+	}
+	sortIssues(diff.Appeared)
+	sortIssues(diff.Disappeared)
+	return
+}
+
+func displayDiff(w io.Writer, diff RunDiff) {
+	fmt.Fprintf(w, "Changes from %s to %s\n", diff.From.Format(time.RFC3339), diff.To.Format(time.RFC3339))
+
+	fmt.Fprintf(w, "\nAppeared\n--------\n")
+	for _, issue := range diff.Appeared {
+		fmt.Fprintf(w, "%s %s %s\n", formatRating(issue), issueLocation(issue), issue.Error)
+	}
+	if len(diff.Appeared) == 0 {
+		fmt.Fprintln(w, "none")
+	}
+
+	fmt.Fprintf(w, "\nDisappeared\n-----------\n")
+	for _, issue := range diff.Disappeared {
+		fmt.Fprintf(w, "%s %s %s\n", formatRating(issue), issueLocation(issue), issue.Error)
+	}
+	if len(diff.Disappeared) == 0 {
+		fmt.Fprintln(w, "none")
+	}
+
+	fmt.Fprintf(w, "\nChanged platform\n----------------\n")
+	for _, change := range diff.Changed {
+		fmt.Fprintf(w, "%s %s -> %s\n", issueLocation(change.After), nonEmptyOr(change.Before.Platform, "none"),
+			nonEmptyOr(change.After.Platform, "none"))
+	}
+	if len(diff.Changed) == 0 {
+		fmt.Fprintln(w, "none")
+	}
+}
+
+// nonEmptyOr returns value, or fallback if value is empty
+func nonEmptyOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// DiffInput specifies the runs to compare
+type DiffInput struct {
+	// StateDir is used to find the two most recent snapshots if From and To aren't set
+	StateDir string
+	// ConfigPath, if set, is read for the state directory when StateDir isn't set
+	ConfigPath string
+	// From and To are the paths of the JSON results to compare. If only From is set, it's compared with the most
+	// recent snapshot.
+	From   string
+	To     string
+	Output string // text or json
+}
+
+// DiffRuns is called from cmd/subtocheck/main.go to show the changes between two runs
+func DiffRuns(input DiffInput) (err error) {
+	if input.StateDir == "" && input.ConfigPath != "" {
+		var conf config
+		if conf, err = readConfig(input.ConfigPath); err != nil {
+			return
+		}
+		input.StateDir = conf.StateDir
+	}
+	if input.From == "" || input.To == "" {
+		if input.StateDir == "" {
+			return errors.New("a state directory or both results files must be specified")
+		}
+		var snapshots []string
+		if snapshots, err = Snapshots(input.StateDir); err != nil {
+			return
+		}
+		switch {
+		case input.From == "" && len(snapshots) >= 2:
+			input.From, input.To = snapshots[len(snapshots)-2], snapshots[len(snapshots)-1]
+		case input.From != "" && len(snapshots) >= 1:
+			input.To = snapshots[len(snapshots)-1]
+		default:
+			return errors.Errorf("not enough snapshots in \"%s\" to compare", input.StateDir)
+		}
+	}
+	var from, to Results
+	if from, err = LoadResults(input.From); err != nil {
+		return
+	}
+	if to, err = LoadResults(input.To); err != nil {
+		return
+	}
+	diff := diffResults(from, to)
+	if input.Output == "json" {
+		return writeJSON(os.Stdout, diff)
+	}
+	displayDiff(os.Stdout, diff)
+	return
+}
@@ -0,0 +1,60 @@
+package subtocheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{time.Hour, 0, 24 * time.Hour} {
+		results := Results{SchemaVersion: ResultsSchemaVersion, Started: started.Add(offset)}
+		if _, err := SaveSnapshot(dir, results); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	if _, err := SaveSnapshot(dir, Results{Started: started}); err == nil {
+		t.Error("expected error overwriting snapshot")
+	}
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("expected three snapshots, got: %v", snapshots)
+	}
+	latest, err := LoadResults(snapshots[2])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !latest.Started.Equal(started.Add(24 * time.Hour)) {
+		t.Errorf("expected snapshots oldest first, got: %v", snapshots)
+	}
+}
+
+func TestDiffResults(t *testing.T) {
+	from := getIssuesSummary(issues{
+		{Kind: "dangling", FQDN: "fixed.example.com"},
+		{Kind: "vuln", FQDN: "shop.example.com", URL: "http://shop.example.com", Platform: "Heroku"},
+		{Kind: "dns", FQDN: "same.example.com"},
+		{Kind: "dangling", FQDN: "accepted.example.com"},
+	})
+	to := getIssuesSummary(issues{
+		{Kind: "vuln", FQDN: "shop.example.com", URL: "http://shop.example.com", Platform: "S3"},
+		{Kind: "dns", FQDN: "same.example.com"},
+		{Kind: "vuln", FQDN: "new.example.com", URL: "http://new.example.com", Platform: "Tumblr"},
+	})
+	// suppressing an issue doesn't mean it has disappeared
+	to.Suppressed = []Issue{{Kind: "dangling", FQDN: "accepted.example.com", SuppressionReason: "accepted"}}
+	diff := diffResults(from, to)
+	if len(diff.Appeared) != 1 || diff.Appeared[0].FQDN != "new.example.com" {
+		t.Errorf("unexpected appeared: %+v", diff.Appeared)
+	}
+	if len(diff.Disappeared) != 1 || diff.Disappeared[0].FQDN != "fixed.example.com" {
+		t.Errorf("unexpected disappeared: %+v", diff.Disappeared)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Before.Platform != "Heroku" || diff.Changed[0].After.Platform != "S3" {
+		t.Errorf("unexpected changed: %+v", diff.Changed)
+	}
+}
@@ -0,0 +1,143 @@
+package subtocheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IPRange is a range of addresses belonging to a cloud provider
+type IPRange struct {
+	Provider string
+	Region   string
+	Service  string
+	Network  *net.IPNet
+}
+
+// ipRangesFile is the union of the published AWS (ip-ranges.json), GCP (cloud.json) and Azure (ServiceTags_*.json)
+// IP range file formats
+type ipRangesFile struct {
+	Prefixes []struct {
+		IPPrefix   string `json:"ip_prefix"`  // AWS
+		IPv4Prefix string `json:"ipv4Prefix"` // GCP
+		IPv6Prefix string `json:"ipv6Prefix"` // GCP
+		Region     string `json:"region"`     // AWS
+		Scope      string `json:"scope"`      // GCP
+		Service    string `json:"service"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+}
+
+// LoadIPRanges reads the cloud provider IP ranges in the file at path. The provider is detected from the format,
+// which must be one of those published by AWS (ip-ranges.json), GCP (cloud.json) or Azure (ServiceTags_*.json).
+func LoadIPRanges(path string) (ranges []IPRange, err error) {
+	var content []byte
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	ranges, err = parseIPRanges(content)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to load IP ranges: \"%s\"", path)
+	}
+	return
+}
+
+func parseIPRanges(content []byte) (ranges []IPRange, err error) {
+	var file ipRangesFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	add := func(provider, region, service, prefix string) error {
+		_, network, parseErr := net.ParseCIDR(prefix)
+		if parseErr != nil {
+			return errors.WithStack(parseErr)
+		}
+		ranges = append(ranges, IPRange{Provider: provider, Region: region, Service: service, Network: network})
+		return nil
+	}
+	for _, prefix := range file.Prefixes {
+		switch {
+		case prefix.IPPrefix != "":
+			err = add("AWS", prefix.Region, prefix.Service, prefix.IPPrefix)
+		case prefix.IPv4Prefix != "":
+			err = add("GCP", prefix.Scope, prefix.Service, prefix.IPv4Prefix)
+		case prefix.IPv6Prefix != "":
+			err = add("GCP", prefix.Scope, prefix.Service, prefix.IPv6Prefix)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range file.IPv6Prefixes {
+		if err = add("AWS", prefix.Region, prefix.Service, prefix.IPv6Prefix); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range file.Values {
+		service := value.Properties.SystemService
+		if service == "" {
+			service = value.Name
+		}
+		for _, prefix := range value.Properties.AddressPrefixes {
+			if err = add("Azure", value.Properties.Region, service, prefix); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		err = errors.New("no IP ranges found")
+	}
+	return
+}
+
+// findIPRange returns the most specific range containing ip, preferring those with a specific service
+func findIPRange(ranges []IPRange, ip net.IP) (match *IPRange) {
+	var matchSize int
+	for i := range ranges {
+		if !ranges[i].Network.Contains(ip) {
+			continue
+		}
+		size, _ := ranges[i].Network.Mask.Size()
+		// AWS lists every range under the AMAZON service as well as the service using it
+		if match == nil || size > matchSize || size == matchSize && match.Service == "AMAZON" {
+			match, matchSize = &ranges[i], size
+		}
+	}
+	return
+}
+
+// checkDanglingIP reports the first of the name's addresses in a cloud provider's range. It's only called when
+// no response was received, as the address may have been released and could be allocated to someone else.
+func (s *Scanner) checkDanglingIP(fqdn string, res resolution) (issues issues) {
+	for _, ip := range append(append([]net.IP{}, res.ipv4...), res.ipv6...) {
+		match := findIPRange(s.opts.IPRanges, ip)
+		if match == nil {
+			continue
+		}
+		description := strings.Join(nonEmpty(match.Provider, match.Region, match.Service), " ")
+		issues = append(issues, Issue{Kind: "ip", FQDN: fqdn, Platform: match.Provider, Region: match.Region,
+			Service: match.Service, CNAMEChain: res.chain, Addresses: res.addresses(),
+			Error: fmt.Sprintf("%s resolves to %s in %s (%s) but did not respond", fqdn, ip, description,
+				match.Network)})
+		return
+	}
+	return
+}
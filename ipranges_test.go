@@ -0,0 +1,71 @@
+package subtocheck
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestParseIPRanges(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		provider string
+		region   string
+		service  string
+		ip       string
+	}{
+		{
+			content: `{"prefixes": [
+				{"ip_prefix": "192.0.2.0/24", "region": "eu-west-1", "service": "AMAZON"},
+				{"ip_prefix": "192.0.2.0/24", "region": "eu-west-1", "service": "EC2"}],
+				"ipv6_prefixes": [{"ipv6_prefix": "2001:db8::/32", "region": "eu-west-1", "service": "AMAZON"}]}`,
+			provider: "AWS", region: "eu-west-1", service: "EC2", ip: "192.0.2.10",
+		},
+		{
+			content: `{"prefixes": [{"ipv4Prefix": "198.51.100.0/24", "service": "Google Cloud",
+				"scope": "us-east1"}, {"ipv6Prefix": "2001:db8::/32", "service": "Google Cloud", "scope": "us-east1"}]}`,
+			provider: "GCP", region: "us-east1", service: "Google Cloud", ip: "2001:db8::1",
+		},
+		{
+			content: `{"values": [{"name": "AzureCloud.westeurope", "properties": {"region": "westeurope",
+				"addressPrefixes": ["203.0.113.0/24"]}}]}`,
+			provider: "Azure", region: "westeurope", service: "AzureCloud.westeurope", ip: "203.0.113.5",
+		},
+	} {
+		ranges, err := parseIPRanges([]byte(test.content))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		match := findIPRange(ranges, net.ParseIP(test.ip))
+		if match == nil || match.Provider != test.provider || match.Region != test.region ||
+			match.Service != test.service {
+			t.Errorf("unexpected match for %s: %+v", test.ip, match)
+		}
+	}
+	if _, err := parseIPRanges([]byte(`{"prefixes": []}`)); err == nil {
+		t.Error("expected error for file without ranges")
+	}
+}
+
+func TestCheckDanglingIP(t *testing.T) {
+	ranges, err := parseIPRanges([]byte(`{"prefixes": [{"ip_prefix": "127.0.0.0/8", "region": "eu-west-1",
+		"service": "EC2"}]}`))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// nothing listens on port 1 so the name doesn't respond
+	resolver := startTestDNSServer(t, map[string][]string{"old.example.com.": {"A 127.0.0.1"}})
+	scanner, err := NewScanner(Options{Resolvers: []string{resolver}, Protocols: []string{"http"}, IPRanges: ranges})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	scanner.httpPort = "1"
+	results, err := scanner.Check(context.Background(), []string{"old.example.com"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(results.DanglingIPs) != 1 || results.DanglingIPs[0].Platform != "AWS" ||
+		results.DanglingIPs[0].Region != "eu-west-1" {
+		t.Errorf("expected dangling IP, got: %+v", results)
+	}
+}
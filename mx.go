@@ -0,0 +1,52 @@
+package subtocheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// checkMX resolves each of the domain's MX hosts and reports those that don't exist, as anyone who can register
+// them can receive the domain's mail, and those matching a provider fingerprint
+func (s *Scanner) checkMX(ctx context.Context, fqdn string) (issues issues) {
+	record, _, _, err := s.exchange(ctx, dns.Fqdn(fqdn), dns.TypeMX)
+	if err != nil || record.Rcode != dns.RcodeSuccess {
+		// failures to resolve the domain itself are reported by checkResolves
+		return
+	}
+	for _, rr := range record.Answer {
+		mx, ok := rr.(*dns.MX)
+		if !ok || !strings.EqualFold(mx.Hdr.Name, dns.Fqdn(fqdn)) || mx.Mx == "." {
+			continue
+		}
+		host := strings.TrimSuffix(mx.Mx, ".")
+		res, _ := s.checkResolves(ctx, host)
+		var match *Fingerprint
+		for i, pattern := range s.opts.Fingerprints {
+			if pattern.checksMX() && (res.nxdomain || !pattern.NXDomain) && pattern.matchesMX(host, res.chain) {
+				match = &s.opts.Fingerprints[i]
+				break
+			}
+		}
+		issue := Issue{Kind: "mx", FQDN: fqdn, MXHost: host, CNAMEChain: res.chain}
+		if match != nil {
+			issue.Platform, issue.Severity, issue.Confidence = match.Platform, match.Severity, match.Confidence
+		}
+		switch {
+		case res.nxdomain && len(res.chain) > 0:
+			issue.Error = fmt.Sprintf("MX host %s is a dangling CNAME (%s does not exist)", host,
+				res.chain[len(res.chain)-1])
+		case res.nxdomain:
+			issue.Error = fmt.Sprintf("MX host %s does not exist", host)
+		case match != nil:
+			issue.Error = fmt.Sprintf("MX host %s belongs to platform: %s (check the domain is still configured)",
+				host, match.Platform)
+		default:
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package subtocheck
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckMX(t *testing.T) {
+	resolver := startTestDNSServer(t, map[string][]string{
+		"example.com.":      {"MX 10 mxa.mailgun.org.", "MX 20 mail.example.com.", "MX 30 old.example.com."},
+		"mxa.mailgun.org.":  {"A 192.0.2.1"},
+		"mail.example.com.": {"A 192.0.2.2"},
+		"old.example.com.":  {"CNAME mail.example.net."},
+	})
+	scanner, err := NewScanner(Options{Resolvers: []string{resolver}, CheckMX: true})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	issues := scanner.checkMX(context.Background(), "example.com")
+	if len(issues) != 2 {
+		t.Fatalf("expected two issues, got: %+v", issues)
+	}
+	for _, issue := range issues {
+		switch issue.MXHost {
+		case "mxa.mailgun.org":
+			if issue.Kind != "mx" || issue.Platform != "Mailgun" {
+				t.Errorf("expected Mailgun mx issue, got: %+v", issue)
+			}
+		case "old.example.com":
+			if issue.Kind != "mx" || len(issue.CNAMEChain) != 1 || issue.CNAMEChain[0] != "mail.example.net" {
+				t.Errorf("expected dangling mx issue, got: %+v", issue)
+			}
+		default:
+			t.Errorf("unexpected issue: %+v", issue)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package subtocheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultNotifyTimeout = 10 * time.Second
+	// maxNotifyIssues is the number of issues listed in chat messages before the rest are summarised
+	maxNotifyIssues = 20
+)
+
+// Notifier sends the results of a run to a destination
+type Notifier interface {
+	// Name describes the destination in errors and debug output
+	Name() string
+	Notify(ctx context.Context, results Results) error
+	// DryRun returns what Notify would send, and the extension of the file it should be saved as, without
+	// sending it
+	DryRun(results Results) (content []byte, ext string, err error)
+}
+
+// summaryLines returns a line counting each kind of issue found and, for potential takeovers, a line for each issue
+func summaryLines(results Results) (lines []string) {
+	lines = append(lines, fmt.Sprintf("subtocheck found %d potential vulnerabilities, %d dangling CNAMEs, "+
+		"%d dangling IPs, %d MX issues, %d DNS issues and %d request issues",
+		len(results.Vulnerabilities), len(results.DanglingCNAMEs), len(results.DanglingIPs), len(results.MX),
+		len(results.DNS), len(results.Request)))
+	var takeovers []Issue
+	for _, group := range [][]Issue{results.Vulnerabilities, results.DanglingCNAMEs, results.DanglingIPs,
+		results.MX} {
+		takeovers = append(takeovers, group...)
+	}
+	sortIssues(takeovers)
+	for i, issue := range takeovers {
+		if i == maxNotifyIssues {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(takeovers)-maxNotifyIssues))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", formatRating(issue), issueLocation(issue), issue.Error))
+	}
+	return
+}
+
+// postJSON sends payload, encoded as JSON, to url and returns an error if the response isn't successful
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string,
+	payload interface{}) (err error) {
+	var body []byte
+	if body, err = json.Marshal(payload); err != nil {
+		return errors.WithStack(err)
+	}
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body)); err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return
+}
+
+// SlackNotifier posts a summary of the results to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// NewSlackNotifier returns a SlackNotifier that posts to the incoming webhook URL
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: defaultNotifyTimeout}}
+}
+
+// Name implements Notifier
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) payload(results Results) interface{} {
+	return map[string]string{"text": strings.Join(summaryLines(results), "\n")}
+}
+
+// Notify implements Notifier
+func (n *SlackNotifier) Notify(ctx context.Context, results Results) error {
+	return postJSON(ctx, n.Client, n.WebhookURL, nil, n.payload(results))
+}
+
+// DryRun implements Notifier
+func (n *SlackNotifier) DryRun(results Results) ([]byte, string, error) {
+	return dryRunJSON(n.payload(results))
+}
+
+// TeamsNotifier posts a summary of the results to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// NewTeamsNotifier returns a TeamsNotifier that posts to the incoming webhook URL
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: defaultNotifyTimeout}}
+}
+
+// Name implements Notifier
+func (n *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (n *TeamsNotifier) payload(results Results) interface{} {
+	lines := summaryLines(results)
+	// Teams renders text as markdown, which needs a blank line between paragraphs
+	return map[string]string{
+		"@type":    "MessageCard",
+		"@context": "http://schema.org/extensions",
+		"summary":  lines[0],
+		"title":    "subtocheck results",
+		"text":     strings.Join(lines, "\n\n"),
+	}
+}
+
+// Notify implements Notifier
+func (n *TeamsNotifier) Notify(ctx context.Context, results Results) error {
+	return postJSON(ctx, n.Client, n.WebhookURL, nil, n.payload(results))
+}
+
+// DryRun implements Notifier
+func (n *TeamsNotifier) DryRun(results Results) ([]byte, string, error) {
+	return dryRunJSON(n.payload(results))
+}
+
+// WebhookNotifier posts the results, as JSON in the same format as --output json, to a URL
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewWebhookNotifier returns a WebhookNotifier that posts to url with the additional headers, e.g. Authorization
+func NewWebhookNotifier(url string, headers map[string]string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Headers: headers, Client: &http.Client{Timeout: defaultNotifyTimeout}}
+}
+
+// Name implements Notifier
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify implements Notifier
+func (n *WebhookNotifier) Notify(ctx context.Context, results Results) error {
+	return postJSON(ctx, n.Client, n.URL, n.Headers, results)
+}
+
+// DryRun implements Notifier
+func (n *WebhookNotifier) DryRun(results Results) ([]byte, string, error) {
+	return dryRunJSON(results)
+}
+
+// emailNotifier sends the results by email using SES or SMTP, or writes the email to a file
+type emailNotifier struct {
+	email emailConfig
+}
+
+// Name implements Notifier
+func (n emailNotifier) Name() string {
+	return "email (" + n.email.Provider + ")"
+}
+
+// Notify implements Notifier
+func (n emailNotifier) Notify(_ context.Context, results Results) error {
+	return emailResults(n.email, results)
+}
+
+// DryRun implements Notifier
+func (n emailNotifier) DryRun(results Results) (raw []byte, ext string, err error) {
+	raw, err = rawEmail(n.email, results)
+	return raw, "eml", err
+}
+
+// dryRunJSON returns the payload a webhook notifier would post, indented for review
+func dryRunJSON(payload interface{}) (content []byte, ext string, err error) {
+	var buf bytes.Buffer
+	if err = writeJSON(&buf, payload); err != nil {
+		return
+	}
+	return buf.Bytes(), "json", nil
+}
+
+// notification is a configured Notifier along with when it should be sent
+type notification struct {
+	notifier    Notifier
+	skipNoVulns bool
+}
+
+// getNotifications returns the notifications in the configuration, including the top level email configuration,
+// along with every problem found with them
+func getNotifications(conf config) (notifications []notification, problems []string) {
+	if emailConfigDefined(conf.Email) {
+		for _, problem := range emailSettingsProblems(conf.Email) {
+			problems = append(problems, "email: "+problem)
+		}
+		notifications = append(notifications, notification{notifier: emailNotifier{email: conf.Email},
+			skipNoVulns: conf.Email.SkipNoVulns})
+	}
+	for i, nc := range conf.Notifications {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("notification %d: %v", i+1, err))
+			continue
+		}
+		if nc.Type == "email" {
+			for _, problem := range emailSettingsProblems(nc.Email) {
+				problems = append(problems, fmt.Sprintf("notification %d: email: %s", i+1, problem))
+			}
+		}
+		notifications = append(notifications, notification{notifier: notifier, skipNoVulns: nc.SkipNoVulns})
+	}
+	if len(problems) > 0 {
+		notifications = nil
+	}
+	return
+}
+
+func newNotifier(nc notificationConfig) (notifier Notifier, err error) {
+	if nc.Type != "email" && nc.URL == "" {
+		return nil, errors.Errorf("%s: url not specified", nc.Type)
+	}
+	switch nc.Type {
+	case "email":
+		if nc.Email.Provider == "" {
+			return nil, errors.New("email: provider not specified")
+		}
+		notifier = emailNotifier{email: nc.Email}
+	case "slack":
+		notifier = NewSlackNotifier(nc.URL)
+	case "teams":
+		notifier = NewTeamsNotifier(nc.URL)
+	case "webhook":
+		notifier = NewWebhookNotifier(nc.URL, nc.Headers)
+	default:
+		return nil, errors.Errorf("unsupported notification type '%s', must be email, slack, teams or webhook",
+			nc.Type)
+	}
+	return
+}
+
+// notify sends the results to each notification, unless there are no issues or the notification skips results
+// without potential takeovers, and returns an error listing any that failed. If dryRunDir is set, what would have
+// been sent is written to files in that directory and printed instead.
+func notify(ctx context.Context, notifications []notification, results Results, dryRunDir string,
+	debug bool) (err error) {
+	if results.empty() {
+		if debug {
+			fmt.Println("\nDEBUG: no issues found. skipping notifications.")
+		}
+		return
+	}
+	var failures []string
+	for i, n := range notifications {
+		if n.skipNoVulns && !results.hasTakeovers() {
+			if debug {
+				fmt.Printf("\nDEBUG: no vulnerabilities found. skipping %s notification.\n", n.notifier.Name())
+			}
+			continue
+		}
+		if dryRunDir != "" {
+			if dryRunErr := dryRun(n.notifier, results, dryRunDir, i+1); dryRunErr != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", n.notifier.Name(), dryRunErr))
+			}
+			continue
+		}
+		if debug {
+			fmt.Printf("\nDEBUG: sending %s notification\n", n.notifier.Name())
+		}
+		if notifyErr := n.notifier.Notify(ctx, results); notifyErr != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", n.notifier.Name(), notifyErr))
+		}
+	}
+	if len(failures) > 0 {
+		err = errors.Errorf("failed to send notifications: %s", strings.Join(failures, "; "))
+	}
+	return
+}
+
+// dryRun writes what the notifier would send to a file in dir and prints it, or for emails the path of the .eml
+// file written. Output goes to stderr so it isn't mixed with results written to stdout, e.g. as JSON.
+func dryRun(notifier Notifier, results Results, dir string, number int) (err error) {
+	content, ext, err := notifier.DryRun(results)
+	if err != nil {
+		return
+	}
+	var path string
+	if path, err = writeFile(dir, fmt.Sprintf("notification_%d", number), ext, content); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nDRY RUN: %s notification written to %s\n", notifier.Name(), path)
+	if ext != "eml" {
+		fmt.Fprintf(os.Stderr, "%s", content)
+	}
+	return
+}
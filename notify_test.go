@@ -0,0 +1,123 @@
+package subtocheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestWebhook returns a server that records the headers and JSON body of each request it receives
+func startTestWebhook(t *testing.T, status int) (url string, headers *http.Header, body map[string]interface{}) {
+	headers = &http.Header{}
+	body = make(map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid JSON: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, headers, body
+}
+
+func TestNotifiers(t *testing.T) {
+	results := getIssuesSummary(issues{
+		{Kind: "vuln", FQDN: "shop.example.com", URL: "http://shop.example.com", Platform: "Heroku",
+			Severity: "high", Confidence: "likely", Error: "matches pattern for platform: Heroku"},
+		{Kind: "dns", FQDN: "old.example.com", Error: "old.example.com could not be resolved"},
+	})
+	ctx := context.Background()
+
+	url, _, body := startTestWebhook(t, http.StatusOK)
+	if err := NewSlackNotifier(url).Notify(ctx, results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if text, _ := body["text"].(string); !strings.Contains(text, "1 potential vulnerabilities") ||
+		!strings.Contains(text, "http://shop.example.com") {
+		t.Errorf("unexpected slack message: %v", body)
+	}
+
+	url, _, body = startTestWebhook(t, http.StatusOK)
+	if err := NewTeamsNotifier(url).Notify(ctx, results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if body["@type"] != "MessageCard" || !strings.Contains(body["text"].(string), "http://shop.example.com") {
+		t.Errorf("unexpected teams message: %v", body)
+	}
+
+	url, headers, body := startTestWebhook(t, http.StatusAccepted)
+	if err := NewWebhookNotifier(url, map[string]string{"Authorization": "Bearer token"}).Notify(ctx,
+		results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if headers.Get("Authorization") != "Bearer token" || headers.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", *headers)
+	}
+	if vulns, _ := body["vulnerabilities"].([]interface{}); len(vulns) != 1 {
+		t.Errorf("unexpected webhook body: %v", body)
+	}
+
+	url, _, _ = startTestWebhook(t, http.StatusInternalServerError)
+	if err := NewSlackNotifier(url).Notify(ctx, results); err == nil {
+		t.Error("expected error for unsuccessful response")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	okURL, _, okBody := startTestWebhook(t, http.StatusOK)
+	skippedURL, _, skippedBody := startTestWebhook(t, http.StatusOK)
+	failedURL, _, _ := startTestWebhook(t, http.StatusInternalServerError)
+	notifications, problems := getNotifications(config{Notifications: []notificationConfig{
+		{Type: "webhook", URL: failedURL},
+		{Type: "slack", URL: okURL},
+		{Type: "teams", URL: skippedURL, SkipNoVulns: true},
+	}})
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	results := getIssuesSummary(issues{{Kind: "dns", FQDN: "old.example.com"}})
+	// a failed notification shouldn't stop the rest from being sent
+	if err := notify(context.Background(), notifications, results, "", false); err == nil ||
+		!strings.Contains(err.Error(), "webhook") {
+		t.Errorf("expected webhook failure, got: %v", err)
+	}
+	if len(okBody) == 0 || len(skippedBody) != 0 {
+		t.Errorf("expected only the slack notification to be sent")
+	}
+
+	for _, nc := range []notificationConfig{{Type: "pager", URL: okURL}, {Type: "slack"}, {Type: "email"}} {
+		if _, err := newNotifier(nc); err == nil {
+			t.Errorf("expected error for notification: %+v", nc)
+		}
+	}
+}
+
+func TestNotifyDryRun(t *testing.T) {
+	url, _, body := startTestWebhook(t, http.StatusOK)
+	notifications, problems := getNotifications(config{
+		Email: emailConfig{Provider: "smtp", Host: "smtp.example.com", Port: "465", Source: "from@example.com",
+			Recipients: []string{"to@example.com"}},
+		Notifications: []notificationConfig{{Type: "webhook", URL: url}},
+	})
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	dir := t.TempDir()
+	results := getIssuesSummary(issues{{Kind: "dns", FQDN: "old.example.com"}})
+	if err := notify(context.Background(), notifications, results, dir, false); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(body) != 0 {
+		t.Error("expected webhook not to be called")
+	}
+	for _, pattern := range []string{"notification_1_*.eml", "notification_2_*.json"} {
+		if paths, _ := filepath.Glob(filepath.Join(dir, pattern)); len(paths) != 1 {
+			t.Errorf("expected a file matching %s, got: %v", pattern, paths)
+		}
+	}
+}
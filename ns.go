@@ -0,0 +1,180 @@
+package subtocheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// checkDelegation looks for an NS delegation of fqdn and, if found, queries each delegated nameserver directly.
+// Nameservers that don't answer authoritatively for the zone are lame and, if they belong to a provider matching
+// a nameserver fingerprint, the zone can potentially be claimed by someone else.
+func (s *Scanner) checkDelegation(ctx context.Context, fqdn string) (issues issues) {
+	zone := dns.Fqdn(fqdn)
+	nameservers, err := s.findDelegation(ctx, zone)
+	if err != nil {
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: failed to find delegation for \"%s\": %v\n", fqdn, err)
+		}
+		return
+	}
+	var lame []string
+	var reasons []string
+	var match *Fingerprint
+	for _, nameserver := range nameservers {
+		reason := s.checkNameserver(ctx, zone, nameserver)
+		if reason == "" {
+			continue
+		}
+		nameserver = strings.TrimSuffix(nameserver, ".")
+		lame = append(lame, nameserver)
+		reasons = append(reasons, fmt.Sprintf("%s %s", nameserver, reason))
+		for i, pattern := range s.opts.Fingerprints {
+			if match == nil && pattern.checksNameservers() && pattern.matchesNameserver(nameserver) {
+				match = &s.opts.Fingerprints[i]
+			}
+		}
+	}
+	switch {
+	case match != nil:
+		issues = append(issues, Issue{Kind: "vuln", FQDN: fqdn, Platform: match.Platform, Severity: match.Severity,
+			Confidence: match.Confidence, Nameservers: lame, Error: fmt.Sprintf("lame delegation to platform: %s (%s)",
+				match.Platform, strings.Join(reasons, ", "))})
+	case len(lame) > 0:
+		// a lame delegation to a provider without a fingerprint may still be claimable
+		issues = append(issues, Issue{Kind: "dns", FQDN: fqdn, Severity: "low", Confidence: "likely", Nameservers: lame,
+			Error: fmt.Sprintf("%s has a lame delegation (%s)", fqdn, strings.Join(reasons, ", "))})
+	}
+	return
+}
+
+// findDelegation returns the nameservers zone is delegated to, or none if it isn't the apex of a zone
+func (s *Scanner) findDelegation(ctx context.Context, zone string) (nameservers []string, err error) {
+	record, _, _, err := s.exchange(ctx, zone, dns.TypeNS)
+	if err != nil {
+		return
+	}
+	switch record.Rcode {
+	case dns.RcodeSuccess:
+		return nsTargets(zone, record.Answer), nil
+	case dns.RcodeServerFailure, dns.RcodeRefused:
+		// the delegated nameservers may be failing so ask the parent zone's nameservers instead
+		return s.findParentDelegation(ctx, zone)
+	}
+	return
+}
+
+// findParentDelegation asks the nameservers of the zone's parent which nameservers it's delegated to
+func (s *Scanner) findParentDelegation(ctx context.Context, zone string) (nameservers []string, err error) {
+	labels := dns.SplitDomainName(zone)
+	if len(labels) < 2 {
+		return
+	}
+	parent := dns.Fqdn(strings.Join(labels[1:], "."))
+	// the SOA returned for the parent name identifies the apex of the zone containing it
+	record, _, _, err := s.exchange(ctx, parent, dns.TypeSOA)
+	if err != nil {
+		return
+	}
+	var parentZone string
+	for _, rr := range append(record.Answer, record.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			parentZone = soa.Hdr.Name
+		}
+	}
+	if parentZone == "" {
+		return nil, errors.Errorf("no SOA found for %s", parent)
+	}
+	if record, _, _, err = s.exchange(ctx, parentZone, dns.TypeNS); err != nil {
+		return
+	}
+	for _, parentNameserver := range nsTargets(parentZone, record.Answer) {
+		address, missing, addrErr := s.resolveAddress(ctx, parentNameserver)
+		if addrErr != nil || missing != "" {
+			err = errors.Errorf("%s %s", parentNameserver, nonEmptyOr(missing, fmt.Sprint(addrErr)))
+			continue
+		}
+		result := s.exchangeWithRetries(ctx, zone, dns.TypeNS, false, func() string { return address })
+		if result.err != nil {
+			err = result.err
+			continue
+		}
+		// a referral lists the delegated nameservers in the authority section
+		return nsTargets(zone, append(result.record.Answer, result.record.Ns...)), nil
+	}
+	if err == nil {
+		err = errors.Errorf("no nameservers found for %s", parentZone)
+	}
+	return
+}
+
+// checkNameserver queries the nameserver directly for the zone's SOA and returns the reason it's lame, or an
+// empty string if it answers authoritatively
+func (s *Scanner) checkNameserver(ctx context.Context, zone, nameserver string) (reason string) {
+	address, missing, err := s.resolveAddress(ctx, nameserver)
+	switch {
+	case err != nil:
+		// as below, failing to resolve the nameserver doesn't show that it no longer exists
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: failed to resolve nameserver %s for \"%s\": %v\n", nameserver, zone, err)
+		}
+		return
+	case missing != "":
+		return missing
+	}
+	result := s.exchangeWithRetries(ctx, zone, dns.TypeSOA, false, func() string { return address })
+	switch {
+	case result.err != nil:
+		// an unreachable nameserver doesn't show that the zone can be claimed
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: nameserver %s did not respond for \"%s\": %v\n", nameserver, zone, result.err)
+		}
+	case result.record.Rcode != dns.RcodeSuccess:
+		reason = fmt.Sprintf("returned %s", result.outcome())
+	case !result.record.Authoritative:
+		reason = "is not authoritative"
+	}
+	return
+}
+
+// resolveAddress returns the address, as host:port, of the first IPv4 address of the nameserver, or its first IPv6
+// address if it has none. If the nameserver doesn't exist (NXDOMAIN), the reason is returned as missing rather than
+// as an error, which is returned if the lookup failed, e.g. it timed out or returned SERVFAIL, or found no address.
+func (s *Scanner) resolveAddress(ctx context.Context, nameserver string) (address, missing string, err error) {
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		var record *dns.Msg
+		if record, _, _, err = s.exchange(ctx, dns.Fqdn(nameserver), qtype); err != nil {
+			return
+		}
+		switch record.Rcode {
+		case dns.RcodeSuccess:
+		case dns.RcodeNameError:
+			return "", "does not resolve (NXDOMAIN)", nil
+		default:
+			return "", "", errors.Errorf("failed to resolve (%s)", dns.RcodeToString[record.Rcode])
+		}
+		for _, rr := range record.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				return net.JoinHostPort(rr.A.String(), s.nsPort), "", nil
+			case *dns.AAAA:
+				return net.JoinHostPort(rr.AAAA.String(), s.nsPort), "", nil
+			}
+		}
+	}
+	return "", "", errors.New("has no address")
+}
+
+// nsTargets returns the targets of the NS records owned by zone
+func nsTargets(zone string, rrs []dns.RR) (targets []string) {
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+			targets = append(targets, ns.Ns)
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package subtocheck
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckDelegation(t *testing.T) {
+	// the parent zone's nameserver refers sub.example.com to Route 53
+	parent := serveTestDNS(t, "127.0.0.2:0", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR("sub.example.com. 300 IN NS ns-1.awsdns-01.org.")
+		if r.Question[0].Name == "flaky.example.com." {
+			rr, _ = dns.NewRR("flaky.example.com. 300 IN NS ns-2.awsdns-02.org.")
+		}
+		m.Ns = append(m.Ns, rr)
+		_ = w.WriteMsg(m)
+	})
+	_, port, _ := net.SplitHostPort(parent)
+	// the delegated nameserver no longer hosts the zone
+	serveTestDNS(t, net.JoinHostPort("127.0.0.3", port), func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		_ = w.WriteMsg(m)
+	})
+	resolver := serveTestDNS(t, "127.0.0.1:0", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		var record string
+		switch q := r.Question[0]; {
+		case q.Name == "sub.example.com." || q.Name == "flaky.example.com.":
+			m.Rcode = dns.RcodeServerFailure
+		case q.Name == "ns-2.awsdns-02.org.":
+			// the resolver fails to look up the nameserver, which doesn't mean it doesn't exist
+			m.Rcode = dns.RcodeServerFailure
+		case q.Name == "example.com." && q.Qtype == dns.TypeSOA:
+			record = "example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300"
+		case q.Name == "example.com." && q.Qtype == dns.TypeNS:
+			record = "example.com. 300 IN NS ns1.example.com."
+		case q.Name == "ns1.example.com." && q.Qtype == dns.TypeA:
+			record = "ns1.example.com. 300 IN A 127.0.0.2"
+		case q.Name == "ns-1.awsdns-01.org." && q.Qtype == dns.TypeA:
+			record = "ns-1.awsdns-01.org. 300 IN A 127.0.0.3"
+		case q.Name == "ns-3.awsdns-03.org." && q.Qtype == dns.TypeAAAA:
+			// a nameserver with only an IPv6 address
+			record = "ns-3.awsdns-03.org. 300 IN AAAA 2001:db8::53"
+		}
+		if record != "" {
+			rr, _ := dns.NewRR(record)
+			m.Answer = append(m.Answer, rr)
+		}
+		_ = w.WriteMsg(m)
+	})
+	scanner, err := NewScanner(Options{Resolvers: []string{resolver}, CheckNS: true})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	scanner.nsPort = port
+	issues := scanner.checkDelegation(context.Background(), "sub.example.com")
+	if len(issues) != 1 || issues[0].Kind != "vuln" || issues[0].Platform != "AWS Route 53" {
+		t.Fatalf("expected Route 53 vulnerability, got: %+v", issues)
+	}
+	if len(issues[0].Nameservers) != 1 || issues[0].Nameservers[0] != "ns-1.awsdns-01.org" {
+		t.Errorf("unexpected nameservers: %v", issues[0].Nameservers)
+	}
+	if issues = scanner.checkDelegation(context.Background(), "flaky.example.com"); len(issues) != 0 {
+		t.Errorf("expected no issues when the nameserver can't be resolved, got: %+v", issues)
+	}
+	address, missing, err := scanner.resolveAddress(context.Background(), "ns-3.awsdns-03.org")
+	if err != nil || missing != "" || address != net.JoinHostPort("2001:db8::53", port) {
+		t.Errorf("expected IPv6 address, got: %s, %s, %v", address, missing, err)
+	}
+}
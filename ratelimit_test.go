@@ -0,0 +1,32 @@
+package subtocheck
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := newRateLimiter(100, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first token is available immediately and each subsequent one after 10ms
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("expected waits to be rate limited, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newRateLimiter(0.001, 1).wait(ctx); err != nil {
+		t.Errorf("expected first token without waiting, got: %v", err)
+	}
+	limiter = newRateLimiter(0.001, 1)
+	_ = limiter.wait(context.Background())
+	if err := limiter.wait(ctx); err == nil {
+		t.Error("expected error waiting with a cancelled context")
+	}
+}
@@ -0,0 +1,186 @@
+package subtocheck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// SystemResolvConf is the path of the system resolver configuration used by SystemResolvers
+const SystemResolvConf = "/etc/resolv.conf"
+
+// LoadResolvers returns the resolvers listed in the file at path, one per line as "host" or "host:port".
+// Blank lines and lines starting with # are ignored.
+func LoadResolvers(path string) (resolvers []string, err error) {
+	var file *os.File
+	file, err = os.Open(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	defer file.Close()
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		line := strings.TrimSpace(lineScanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			resolvers = append(resolvers, line)
+		}
+	}
+	if err = lineScanner.Err(); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if len(resolvers) == 0 {
+		err = errors.Errorf("no resolvers found in %s", path)
+	}
+	return
+}
+
+// SystemResolvers returns the nameservers in the resolv.conf(5) file at path, e.g. SystemResolvConf, as host:port
+func SystemResolvers(path string) (resolvers []string, err error) {
+	var conf *dns.ClientConfig
+	conf, err = dns.ClientConfigFromFile(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	for _, server := range conf.Servers {
+		resolvers = append(resolvers, net.JoinHostPort(server, conf.Port))
+	}
+	if len(resolvers) == 0 {
+		err = errors.Errorf("no nameservers found in %s", path)
+	}
+	return
+}
+
+// queryResult is the outcome of a query sent to a single resolver
+type queryResult struct {
+	ns     string
+	record *dns.Msg
+	err    error
+}
+
+// outcome summarises the result as the response code or "error" if no response was received
+func (result queryResult) outcome() string {
+	if result.err != nil {
+		return "error"
+	}
+	return dns.RcodeToString[result.record.Rcode]
+}
+
+// retryable returns true if a failure may be transient and worth retrying
+func (result queryResult) retryable() bool {
+	if result.err != nil {
+		return !errors.Is(result.err, context.Canceled) && !errors.Is(result.err, context.DeadlineExceeded)
+	}
+	return result.record.Rcode == dns.RcodeServerFailure || result.record.Rcode == dns.RcodeRefused
+}
+
+// exchange sends a recursive query for name and returns the response along with the resolver that sent it. If
+// consensus is enabled then the query is sent to multiple resolvers and the response agreed by the majority is
+// returned, along with a description of each resolver that disagreed.
+func (s *Scanner) exchange(ctx context.Context, name string, qtype uint16) (record *dns.Msg, ns string,
+	disagreements []string, err error) {
+	if s.opts.Consensus <= 1 {
+		result := s.exchangeWithRetries(ctx, name, qtype, true, func() string {
+			return s.opts.Resolvers[rand.Intn(len(s.opts.Resolvers))]
+		})
+		return result.record, result.ns, nil, result.err
+	}
+
+	resultsChan := make(chan queryResult, s.opts.Consensus)
+	for _, i := range rand.Perm(len(s.opts.Resolvers))[:s.opts.Consensus] {
+		resolver := s.opts.Resolvers[i]
+		go func() {
+			resultsChan <- s.exchangeWithRetries(ctx, name, qtype, true, func() string { return resolver })
+		}()
+	}
+	var results []queryResult
+	counts := make(map[string]int)
+	for i := 0; i < s.opts.Consensus; i++ {
+		result := <-resultsChan
+		results = append(results, result)
+		counts[result.outcome()]++
+	}
+	var agreed string
+	for outcome, count := range counts {
+		if count*2 > s.opts.Consensus {
+			agreed = outcome
+		}
+	}
+	// without a majority a name is only reported if no resolver could resolve it
+	if agreed == "" && counts[dns.RcodeToString[dns.RcodeSuccess]] > 0 {
+		agreed = dns.RcodeToString[dns.RcodeSuccess]
+	}
+	for _, result := range results {
+		if result.outcome() != agreed {
+			disagreements = append(disagreements, fmt.Sprintf("%s: %s", result.ns, result.outcome()))
+		} else if record == nil && result.err == nil {
+			record, ns = result.record, result.ns
+		} else if result.err != nil && err == nil {
+			ns, err = result.ns, result.err
+		}
+	}
+	if s.opts.Debug && len(disagreements) > 0 {
+		fmt.Printf("DEBUG: resolvers disagreed resolving \"%s\" (%s): %s\n", name, dns.TypeToString[qtype],
+			strings.Join(disagreements, ", "))
+	}
+	if agreed == "" {
+		err = errors.Errorf("no consensus between %d resolvers", s.opts.Consensus)
+	}
+	return
+}
+
+// exchangeWithRetries sends the query to the nameserver returned by next, retrying with exponential backoff
+// whilst the failure may be transient
+func (s *Scanner) exchangeWithRetries(ctx context.Context, name string, qtype uint16, recursive bool,
+	next func() string) (result queryResult) {
+	backoff := s.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		result.ns = next()
+		result.record, result.err = s.exchangeWith(ctx, result.ns, name, qtype, recursive)
+		if attempt >= s.opts.Retries || !result.retryable() {
+			return
+		}
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: retrying \"%s\" (%s) in %v after %s from %s\n", name, dns.TypeToString[qtype],
+				backoff, result.outcome(), result.ns)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// exchangeWith sends a query for name to nameserver ns, waiting for that nameserver's rate limiter if one
+// is configured
+func (s *Scanner) exchangeWith(ctx context.Context, ns, name string, qtype uint16, recursive bool) (record *dns.Msg,
+	err error) {
+	if limiter := s.limiters[ns]; limiter != nil {
+		if err = limiter.wait(ctx); err != nil {
+			return
+		}
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = recursive
+	c := &dns.Client{Timeout: s.opts.DNSTimeout}
+	if s.opts.Debug {
+		fmt.Printf("DEBUG: resolving \"%s\" (%s) with nameserver %s\n", name, dns.TypeToString[qtype], ns)
+	}
+	record, _, err = c.ExchangeContext(ctx, m, ns)
+	return
+}
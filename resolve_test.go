@@ -0,0 +1,69 @@
+package subtocheck
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadResolvers(t *testing.T) {
+	dir := t.TempDir()
+	resolversPath := filepath.Join(dir, "resolvers.txt")
+	if err := os.WriteFile(resolversPath, []byte("# internal\n10.0.0.2\n\n127.0.0.1:5353\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resolvers, err := LoadResolvers(resolversPath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(resolvers) != 2 || resolvers[0] != "10.0.0.2" || resolvers[1] != "127.0.0.1:5353" {
+		t.Errorf("unexpected resolvers: %v", resolvers)
+	}
+
+	resolvConfPath := filepath.Join(dir, "resolv.conf")
+	if err = os.WriteFile(resolvConfPath, []byte("search example.com\nnameserver 10.0.0.53\nnameserver ::1\n"),
+		0o600); err != nil {
+		t.Fatal(err)
+	}
+	if resolvers, err = SystemResolvers(resolvConfPath); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(resolvers) != 2 || resolvers[0] != "10.0.0.53:53" || resolvers[1] != "[::1]:53" {
+		t.Errorf("unexpected system resolvers: %v", resolvers)
+	}
+}
+
+func TestScannerConsensus(t *testing.T) {
+	dangling := map[string][]string{"www.example.com.": {"CNAME app.example.net."}}
+	resolving := map[string][]string{
+		"www.example.com.": {"CNAME app.example.net."},
+		"app.example.net.": {"A 192.0.2.1"},
+	}
+	resolvers := []string{startTestDNSServer(t, dangling), startTestDNSServer(t, dangling),
+		startTestDNSServer(t, resolving)}
+	scanner, err := NewScanner(Options{Resolvers: resolvers, Consensus: 3})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, issues := scanner.checkResolves(context.Background(), "www.example.com")
+	if len(issues) != 1 || issues[0].Kind != "dangling" {
+		t.Fatalf("expected dangling issue, got: %+v", issues)
+	}
+	if len(issues[0].ResolverDisagreements) != 1 || issues[0].ResolverDisagreements[0] != resolvers[2]+": NOERROR" {
+		t.Errorf("unexpected disagreements: %v", issues[0].ResolverDisagreements)
+	}
+
+	resolvers = []string{resolvers[0], resolvers[2], startTestDNSServer(t, resolving)}
+	if scanner, err = NewScanner(Options{Resolvers: resolvers, Consensus: 3}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if res, issues := scanner.checkResolves(context.Background(), "www.example.com"); len(issues) != 0 ||
+		len(res.chain) != 1 {
+		t.Errorf("expected majority to resolve, got chain %v and issues: %+v", res.chain, issues)
+	}
+
+	if _, err = NewScanner(Options{Resolvers: resolvers, Consensus: 4}); err == nil {
+		t.Error("expected error with consensus greater than the number of resolvers")
+	}
+}
@@ -0,0 +1,157 @@
+package subtocheck
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ResultsSchemaVersion is incremented whenever a change to Results or Issue would break existing consumers
+const ResultsSchemaVersion = 1
+
+// Issue is a problem found whilst checking a single FQDN
+type Issue struct {
+	// Kind is one of: vuln, dangling, ip, mx, dns, request
+	Kind string `json:"kind"`
+	// Platform is the name of the matching fingerprint, for vuln and mx issues, or the cloud provider for ip issues
+	Platform string `json:"platform"`
+	// Region and Service are the cloud provider's region and service, for ip issues only
+	Region  string `json:"region"`
+	Service string `json:"service"`
+	// Severity is one of: info, low, medium, high, critical
+	Severity string `json:"severity"`
+	// Confidence is one of: informational, likely, confirmed
+	Confidence string `json:"confidence"`
+	FQDN       string `json:"fqdn"`
+	// URL is the URL requested, for issues found whilst making requests
+	URL   string `json:"url"`
+	Error string `json:"error"`
+	// CNAMEChain is the target of each CNAME followed when resolving the FQDN
+	CNAMEChain []string `json:"cname_chain"`
+	// Addresses are the IPv4 and IPv6 addresses the FQDN resolved to, for issues found whilst making requests
+	Addresses []string `json:"addresses"`
+	// AddressFamily is the address family requests were made over: ipv4, or ipv6 if there were no IPv4 addresses
+	AddressFamily string `json:"address_family"`
+	// StatusCode is the status code of the response the issue was found in, for vuln issues found by requests only
+	StatusCode int `json:"status_code"`
+	// MXHost is the MX host the issue was found with, for mx issues only
+	MXHost string `json:"mx_host"`
+	// Nameservers are the lame nameservers the FQDN is delegated to, for delegation issues only
+	Nameservers []string `json:"nameservers"`
+	// SuppressionReason is the reason given for suppressing the issue, for suppressed issues only
+	SuppressionReason string `json:"suppression_reason"`
+	// ResolverDisagreements lists the resolvers, and their responses, that disagreed with the majority
+	// when resolving in consensus mode
+	ResolverDisagreements []string  `json:"resolver_disagreements"`
+	Time                  time.Time `json:"time"`
+}
+
+// Results contains the issues found by a scan, grouped by kind
+type Results struct {
+	SchemaVersion   int       `json:"schema_version"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	Vulnerabilities []Issue   `json:"vulnerabilities"`
+	DanglingCNAMEs  []Issue   `json:"dangling_cnames"`
+	DanglingIPs     []Issue   `json:"dangling_ips"`
+	MX              []Issue   `json:"mx"`
+	DNS             []Issue   `json:"dns"`
+	Request         []Issue   `json:"request"`
+	// Suppressed are issues of any kind that match a suppression
+	Suppressed []Issue `json:"suppressed"`
+	// Unchanged are issues of any kind that are also in the baseline. They aren't reported, but are kept so that
+	// these results can be used as the baseline for the next run.
+	Unchanged []Issue `json:"unchanged"`
+}
+
+// empty returns true if the results contain no issues
+func (results Results) empty() bool {
+	return len(results.Vulnerabilities) == 0 && len(results.DanglingCNAMEs) == 0 &&
+		len(results.DanglingIPs) == 0 && len(results.MX) == 0 &&
+		len(results.DNS) == 0 && len(results.Request) == 0
+}
+
+// hasTakeovers returns true if the results contain potential takeovers: vuln, dangling, ip or mx issues
+func (results Results) hasTakeovers() bool {
+	return len(results.Vulnerabilities) > 0 || len(results.DanglingCNAMEs) > 0 || len(results.DanglingIPs) > 0 ||
+		len(results.MX) > 0
+}
+
+// each returns the results with each group of unsuppressed issues replaced by the result of f
+func (results Results) each(f func([]Issue) []Issue) Results {
+	results.Vulnerabilities = f(results.Vulnerabilities)
+	results.DanglingCNAMEs = f(results.DanglingCNAMEs)
+	results.DanglingIPs = f(results.DanglingIPs)
+	results.MX = f(results.MX)
+	results.DNS = f(results.DNS)
+	results.Request = f(results.Request)
+	return results
+}
+
+// byKind returns the issues keyed by their kind
+func (results Results) byKind() map[string][]Issue {
+	return map[string][]Issue{
+		"vuln":     results.Vulnerabilities,
+		"dangling": results.DanglingCNAMEs,
+		"ip":       results.DanglingIPs,
+		"mx":       results.MX,
+		"dns":      results.DNS,
+		"request":  results.Request,
+	}
+}
+
+func getIssuesSummary(issues issues) (results Results) {
+	results.SchemaVersion = ResultsSchemaVersion
+	for _, issue := range issues {
+		switch issue.Kind {
+		case "request":
+			results.Request = append(results.Request, issue)
+		case "dns":
+			results.DNS = append(results.DNS, issue)
+		case "dangling":
+			results.DanglingCNAMEs = append(results.DanglingCNAMEs, issue)
+		case "ip":
+			results.DanglingIPs = append(results.DanglingIPs, issue)
+		case "mx":
+			results.MX = append(results.MX, issue)
+		case "vuln":
+			results.Vulnerabilities = append(results.Vulnerabilities, issue)
+		}
+	}
+	for _, group := range [][]Issue{results.Vulnerabilities, results.DanglingCNAMEs, results.DanglingIPs, results.MX,
+		results.DNS, results.Request} {
+		sortIssues(group)
+	}
+	return
+}
+
+// LoadResults reads results previously written with --output json from the file at path
+func LoadResults(path string) (results Results, err error) {
+	var content []byte
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if err = json.Unmarshal(content, &results); err != nil {
+		err = errors.Wrapf(err, "failed to parse results: \"%s\"", path)
+		return
+	}
+	if results.SchemaVersion != ResultsSchemaVersion {
+		err = errors.Errorf("results \"%s\" have schema version %d but version %d is required", path,
+			results.SchemaVersion, ResultsSchemaVersion)
+	}
+	return
+}
+
+func writeJSON(w io.Writer, v interface{}) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(v); err != nil {
+		err = errors.WithStack(err)
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package subtocheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	results := getIssuesSummary(issues{
+		{Kind: "vuln", Platform: "Heroku", FQDN: "a.example.com", URL: "http://a.example.com",
+			CNAMEChain: []string{"a.herokuapp.com"}, Error: "matches pattern for platform: Heroku"},
+		{Kind: "dns", FQDN: "b.example.com", Error: "b.example.com could not be resolved"},
+	})
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, results); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"schema_version", "started", "finished", "vulnerabilities", "dangling_cnames", "dns",
+		"request", "suppressed", "unchanged"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("missing key: %s", key)
+		}
+	}
+	vuln := doc["vulnerabilities"].([]interface{})[0].(map[string]interface{})
+	for _, key := range []string{"kind", "platform", "fqdn", "url", "error", "cname_chain", "time"} {
+		if _, ok := vuln[key]; !ok {
+			t.Errorf("missing issue key: %s", key)
+		}
+	}
+}
+
+func TestHasTakeovers(t *testing.T) {
+	for kind, expected := range map[string]bool{"vuln": true, "dangling": true, "ip": true, "mx": true, "dns": false,
+		"request": false} {
+		if got := getIssuesSummary(issues{{Kind: kind}}).hasTakeovers(); got != expected {
+			t.Errorf("%s: expected %v, got %v", kind, expected, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package subtocheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultWorkers               = 10
+	defaultDNSTimeout            = 1500 * time.Millisecond
+	defaultHTTPTimeout           = 3 * time.Second
+	defaultResponseHeaderTimeout = 2 * time.Second
+	defaultRetryBackoff          = 250 * time.Millisecond
+	defaultMaxBodySize           = 1 << 20
+)
+
+var defaultNameservers = []string{
+	"8.8.8.8",         // google
+	"8.8.4.4",         // google
+	"209.244.0.3",     // level3
+	"209.244.0.4",     // level3
+	"1.1.1.1",         // cloudflare
+	"1.0.0.1",         // cloudflare
+	"9.9.9.9",         // quad9
+	"149.112.112.112", // quad9
+}
+
+// Options configures a Scanner. Any fields left unset use the defaults.
+type Options struct {
+	// Workers is the number of domains checked concurrently (default 10)
+	Workers int
+	// DNSTimeout is the timeout for each DNS query (default 1.5s)
+	DNSTimeout time.Duration
+	// HTTPTimeout is the timeout for each HTTP request, including reading the response (default 3s)
+	HTTPTimeout time.Duration
+	// ResponseHeaderTimeout is the time to wait for response headers (default 2s)
+	ResponseHeaderTimeout time.Duration
+	// MaxBodySize is the number of bytes of each response body matched against fingerprints (default 1MiB)
+	MaxBodySize int64
+	// Resolvers are the nameservers to query, as "host" or "host:port" (default public resolvers)
+	Resolvers []string
+	// ResolverQPS limits the queries per second sent to each resolver (default unlimited)
+	ResolverQPS float64
+	// Retries is the number of times a query that times out or fails with SERVFAIL or REFUSED is retried
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubling for each subsequent retry (default 250ms)
+	RetryBackoff time.Duration
+	// Consensus, if greater than one, is the number of resolvers each query is sent to. NXDOMAIN and SERVFAIL
+	// responses are only reported if the majority agree.
+	Consensus int
+	// Protocols are the schemes used to request each domain: http and/or https (default both)
+	Protocols []string
+	// Fingerprints are matched against each domain (default built-in fingerprints)
+	Fingerprints []Fingerprint
+	// CheckNS checks whether each domain is delegated to nameservers that are lame
+	CheckNS bool
+	// CheckMX checks whether each domain's MX hosts exist and match provider fingerprints
+	CheckMX bool
+	// IPRanges are cloud provider address ranges. Names that don't respond and resolve to an address in one of
+	// them are reported as the address may have been released.
+	IPRanges []IPRange
+	// Debug writes details of each check to stdout
+	Debug bool
+	// Progress, if set, is called after each domain has been checked
+	Progress func(done, total int, fqdn string)
+}
+
+// Scanner checks domains for potential subdomain takeovers
+type Scanner struct {
+	opts     Options
+	limiters map[string]*rateLimiter
+	// nsPort is the port authoritative nameservers are queried on
+	nsPort string
+	// httpPort, if set, overrides the port requests are made to
+	httpPort string
+}
+
+// NewScanner validates the options and returns a Scanner that uses them
+func NewScanner(opts Options) (scanner *Scanner, err error) {
+	if opts.Workers < 0 {
+		return nil, errors.Errorf("invalid number of workers: %d", opts.Workers)
+	}
+	if opts.Workers == 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.DNSTimeout == 0 {
+		opts.DNSTimeout = defaultDNSTimeout
+	}
+	if opts.HTTPTimeout == 0 {
+		opts.HTTPTimeout = defaultHTTPTimeout
+	}
+	if opts.ResponseHeaderTimeout == 0 {
+		opts.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	}
+	if opts.MaxBodySize < 0 {
+		return nil, errors.Errorf("invalid maximum body size: %d", opts.MaxBodySize)
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = defaultMaxBodySize
+	}
+	if len(opts.Resolvers) == 0 {
+		opts.Resolvers = defaultNameservers
+	}
+	resolvers := make([]string, len(opts.Resolvers))
+	for i, resolver := range opts.Resolvers {
+		if resolvers[i], err = normaliseResolver(resolver); err != nil {
+			return nil, err
+		}
+	}
+	opts.Resolvers = resolvers
+	if opts.ResolverQPS < 0 {
+		return nil, errors.Errorf("invalid resolver QPS: %v", opts.ResolverQPS)
+	}
+	if opts.Retries < 0 {
+		return nil, errors.Errorf("invalid number of retries: %d", opts.Retries)
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+	if opts.Consensus < 0 || opts.Consensus > len(opts.Resolvers) {
+		return nil, errors.Errorf("consensus of %d requires at least as many resolvers but %d are configured",
+			opts.Consensus, len(opts.Resolvers))
+	}
+	if len(opts.Protocols) == 0 {
+		opts.Protocols = []string{"http", "https"}
+	}
+	for _, protocol := range opts.Protocols {
+		if protocol != "http" && protocol != "https" {
+			return nil, errors.Errorf("unsupported protocol: %s", protocol)
+		}
+	}
+	if opts.Fingerprints == nil {
+		if opts.Fingerprints, err = DefaultFingerprints(); err != nil {
+			return nil, err
+		}
+	} else {
+		// validate a copy so the caller's fingerprints aren't modified, including the header matchers that validation
+		// compiles regular expressions into
+		fingerprints := make([]Fingerprint, len(opts.Fingerprints))
+		copy(fingerprints, opts.Fingerprints)
+		for i := range fingerprints {
+			fingerprints[i].Headers = append([]HeaderMatcher(nil), fingerprints[i].Headers...)
+			fingerprints[i].ExcludeHeaders = append([]HeaderMatcher(nil), fingerprints[i].ExcludeHeaders...)
+			if err = validateFingerprint(&fingerprints[i]); err != nil {
+				return nil, errors.Wrapf(err, "fingerprint %d", i+1)
+			}
+		}
+		opts.Fingerprints = fingerprints
+	}
+	scanner = &Scanner{opts: opts, nsPort: "53"}
+	if opts.ResolverQPS > 0 {
+		scanner.limiters = make(map[string]*rateLimiter, len(opts.Resolvers))
+		for _, resolver := range opts.Resolvers {
+			scanner.limiters[resolver] = newRateLimiter(opts.ResolverQPS, 1)
+		}
+	}
+	return
+}
+
+// normaliseResolver returns the resolver as host:port, using port 53 if one isn't specified
+func normaliseResolver(resolver string) (string, error) {
+	if host, port, err := net.SplitHostPort(resolver); err == nil {
+		if host == "" || port == "" {
+			return "", errors.Errorf("invalid resolver: %s", resolver)
+		}
+		return resolver, nil
+	}
+	if resolver == "" {
+		return "", errors.New("invalid resolver: empty")
+	}
+	return net.JoinHostPort(resolver, "53"), nil
+}
+
+// domainResult is sent from a worker to the collector once a domain has been checked
+type domainResult struct {
+	fqdn   string
+	issues issues
+}
+
+// Check checks each of the domains and returns the issues found. If the context is cancelled then the results of
+// the domains checked so far are returned along with the context's error.
+func (s *Scanner) Check(ctx context.Context, domains []string) (results Results, err error) {
+	started := time.Now().UTC()
+	jobs := make(chan string, len(domains))
+	done := make(chan domainResult, len(domains))
+
+	for w := 1; w <= s.opts.Workers; w++ {
+		go s.worker(ctx, w, jobs, done)
+	}
+	numDomains := len(domains)
+	for j := 0; j < numDomains; j++ {
+		jobs <- domains[j]
+	}
+	close(jobs)
+
+	var domainIssues issues
+	for a := 1; a <= numDomains; a++ {
+		result := <-done
+		domainIssues = append(domainIssues, result.issues...)
+		if s.opts.Progress != nil {
+			s.opts.Progress(a, numDomains, result.fqdn)
+		}
+	}
+	results = getIssuesSummary(domainIssues)
+	results.Started = started
+	results.Finished = time.Now().UTC()
+	err = ctx.Err()
+	return
+}
+
+func (s *Scanner) worker(ctx context.Context, id int, jobs <-chan string, done chan<- domainResult) {
+	for j := range jobs {
+		// drain remaining jobs without checking them once cancelled
+		if ctx.Err() != nil {
+			done <- domainResult{fqdn: j}
+			continue
+		}
+		if s.opts.Debug {
+			fmt.Printf("DEBUG: worker: %d\n", id)
+		}
+		res, jobIssues := s.checkResolves(ctx, j)
+		if len(jobIssues) == 0 {
+			var responded bool
+			jobIssues, responded = s.checkResponse(ctx, j, res)
+			if !responded && len(s.opts.IPRanges) > 0 {
+				jobIssues = append(jobIssues, s.checkDanglingIP(j, res)...)
+			}
+		}
+		if s.opts.CheckNS {
+			jobIssues = append(jobIssues, s.checkDelegation(ctx, j)...)
+		}
+		if s.opts.CheckMX {
+			jobIssues = append(jobIssues, s.checkMX(ctx, j)...)
+		}
+		checked := time.Now().UTC()
+		for i := range jobIssues {
+			jobIssues[i].Time = checked
+			jobIssues[i].rate()
+		}
+		done <- domainResult{fqdn: j, issues: jobIssues}
+	}
+}
@@ -0,0 +1,153 @@
+package subtocheck
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startTestDNSServer serves the records in zone from a local UDP server and returns its address. Names without
+// records return NXDOMAIN.
+func startTestDNSServer(t *testing.T, zone map[string][]string) string {
+	t.Helper()
+	return serveTestDNS(t, "127.0.0.1:0", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		name := r.Question[0].Name
+		// follow CNAMEs in the zone as a recursive resolver would
+		for i := 0; i < maxCNAMEHops; i++ {
+			records, ok := zone[name]
+			if !ok {
+				m.Rcode = dns.RcodeNameError
+				break
+			}
+			var next string
+			for _, record := range records {
+				rr, rrErr := dns.NewRR(name + " 300 IN " + record)
+				if rrErr != nil {
+					t.Error(rrErr)
+					return
+				}
+				if cname, isCNAME := rr.(*dns.CNAME); isCNAME {
+					next = cname.Target
+				}
+				if rr.Header().Rrtype == r.Question[0].Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			if next == "" {
+				break
+			}
+			name = next
+		}
+		_ = w.WriteMsg(m)
+	})
+}
+
+// serveTestDNS serves DNS queries to address with handler and returns the address listened on
+func serveTestDNS(t *testing.T, address string, handler dns.HandlerFunc) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: handler}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return pc.LocalAddr().String()
+}
+
+func TestNewScannerDefaults(t *testing.T) {
+	scanner, err := NewScanner(Options{Resolvers: []string{"192.0.2.1", "192.0.2.2:5353", "::1"}})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := []string{"192.0.2.1:53", "192.0.2.2:5353", "[::1]:53"}
+	for i, resolver := range scanner.opts.Resolvers {
+		if resolver != expected[i] {
+			t.Errorf("expected resolver %s, got %s", expected[i], resolver)
+		}
+	}
+	if scanner.opts.Workers != defaultWorkers || len(scanner.opts.Fingerprints) == 0 {
+		t.Errorf("defaults not applied: %+v", scanner.opts)
+	}
+	for _, opts := range []Options{{Workers: -1}, {Protocols: []string{"ftp"}}, {Resolvers: []string{":53"}},
+		{Fingerprints: []Fingerprint{{Platform: "Example"}}}} {
+		if _, err = NewScanner(opts); err == nil {
+			t.Errorf("expected error for options: %+v", opts)
+		}
+	}
+}
+
+func TestNewScannerCopiesFingerprints(t *testing.T) {
+	fingerprints := []Fingerprint{{Platform: "Example", CNAMEs: []string{"example.net"},
+		Headers: []HeaderMatcher{{Name: "Server", Regex: "^example"}}}}
+	// scanners sharing fingerprints mustn't race on compiling their header matchers
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewScanner(Options{Fingerprints: fingerprints}); err != nil {
+				t.Errorf("%+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fingerprints[0].Headers[0].re != nil {
+		t.Error("expected the caller's fingerprints not to be modified")
+	}
+}
+
+func TestScannerCheckDangling(t *testing.T) {
+	resolver := startTestDNSServer(t, map[string][]string{
+		"www.example.com.": {"CNAME app.azurewebsites.net."},
+		"old.example.com.": {"CNAME old.example.net."},
+	})
+	scanner, err := NewScanner(Options{Resolvers: []string{resolver}, Workers: 2})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	results, err := scanner.Check(context.Background(), []string{"www.example.com", "old.example.com"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(results.Vulnerabilities) != 1 || results.Vulnerabilities[0].Platform != "Azure" {
+		t.Errorf("expected Azure vulnerability, got: %+v", results.Vulnerabilities)
+	}
+	if len(results.DanglingCNAMEs) != 1 || results.DanglingCNAMEs[0].FQDN != "old.example.com" {
+		t.Errorf("expected dangling CNAME, got: %+v", results.DanglingCNAMEs)
+	}
+	if chain := results.DanglingCNAMEs[0].CNAMEChain; len(chain) != 1 || chain[0] != "old.example.net" {
+		t.Errorf("unexpected CNAME chain: %v", chain)
+	}
+}
+
+func TestScannerCheckDoesNotAccumulate(t *testing.T) {
+	zone := map[string][]string{}
+	var domains []string
+	for _, label := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		zone[label+".example.com."] = []string{"CNAME " + label + ".example.net."}
+		domains = append(domains, label+".example.com")
+	}
+	scanner, err := NewScanner(Options{Resolvers: []string{startTestDNSServer(t, zone)}, Workers: 4})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for run := 1; run <= 2; run++ {
+		results, checkErr := scanner.Check(context.Background(), domains)
+		if checkErr != nil {
+			t.Fatalf("%+v", checkErr)
+		}
+		if len(results.DanglingCNAMEs) != len(domains) {
+			t.Errorf("run %d: expected %d dangling CNAMEs, got %d", run, len(domains), len(results.DanglingCNAMEs))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package subtocheck
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Severities, from least to most severe
+var severities = []string{"info", "low", "medium", "high", "critical"}
+
+// Confidences, from least to most confident that an issue can be exploited
+var confidences = []string{"informational", "likely", "confirmed"}
+
+// rating is the severity and confidence of an issue
+type rating struct {
+	severity   string
+	confidence string
+}
+
+// defaultRatings are the ratings of issues that aren't found by a fingerprint specifying its own
+var defaultRatings = map[string]rating{
+	"vuln":     {"high", "likely"},
+	"dangling": {"medium", "likely"},
+	"ip":       {"medium", "likely"},
+	"mx":       {"high", "likely"},
+	"dns":      {"info", "informational"},
+	"request":  {"info", "informational"},
+}
+
+// rank returns the position of value in levels, or -1 if it isn't one of them
+func rank(levels []string, value string) int {
+	for i, level := range levels {
+		if level == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// ValidateSeverity returns an error if severity isn't one of: info, low, medium, high, critical
+func ValidateSeverity(severity string) error {
+	if rank(severities, severity) < 0 {
+		return errors.Errorf("invalid severity '%s', must be one of: %s", severity, strings.Join(severities, ", "))
+	}
+	return nil
+}
+
+func validateConfidence(confidence string) error {
+	if rank(confidences, confidence) < 0 {
+		return errors.Errorf("invalid confidence '%s', must be one of: %s", confidence,
+			strings.Join(confidences, ", "))
+	}
+	return nil
+}
+
+// rate sets the issue's severity and confidence to the defaults for its kind, unless already set
+func (issue *Issue) rate() {
+	defaults := defaultRatings[issue.Kind]
+	if issue.Severity == "" {
+		issue.Severity = defaults.severity
+	}
+	if issue.Confidence == "" {
+		issue.Confidence = defaults.confidence
+	}
+}
+
+// atLeast returns true if the issue's severity is the same as, or more severe than, minSeverity
+func (issue Issue) atLeast(minSeverity string) bool {
+	return rank(severities, issue.Severity) >= rank(severities, minSeverity)
+}
+
+// sortIssues orders issues by severity and then confidence, most severe and confident first, and then by
+// location so the order is stable between runs
+func sortIssues(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if a, b := rank(severities, issues[i].Severity), rank(severities, issues[j].Severity); a != b {
+			return a > b
+		}
+		if a, b := rank(confidences, issues[i].Confidence), rank(confidences, issues[j].Confidence); a != b {
+			return a > b
+		}
+		return issueLocation(issues[i]) < issueLocation(issues[j])
+	})
+}
+
+// filterIssues returns the issues at or above minSeverity
+func filterIssues(issues []Issue, minSeverity string) (filtered []Issue) {
+	for _, issue := range issues {
+		if issue.atLeast(minSeverity) {
+			filtered = append(filtered, issue)
+		}
+	}
+	return
+}
+
+// filter returns the results with only the issues at or above minSeverity
+func (results Results) filter(minSeverity string) Results {
+	return results.each(func(issues []Issue) []Issue {
+		return filterIssues(issues, minSeverity)
+	})
+}
@@ -0,0 +1,45 @@
+package subtocheck
+
+import (
+	"testing"
+)
+
+func TestGetIssuesSummarySortsBySeverity(t *testing.T) {
+	results := getIssuesSummary(issues{
+		{Kind: "vuln", FQDN: "b.example.com", Severity: "high", Confidence: "likely"},
+		{Kind: "vuln", FQDN: "c.example.com", Severity: "critical", Confidence: "likely"},
+		{Kind: "vuln", FQDN: "a.example.com", Severity: "high", Confidence: "likely"},
+		{Kind: "vuln", FQDN: "d.example.com", Severity: "high", Confidence: "confirmed"},
+		{Kind: "dns", FQDN: "e.example.com", Severity: "info", Confidence: "informational"},
+	})
+	var order []string
+	for _, issue := range results.Vulnerabilities {
+		order = append(order, issue.FQDN)
+	}
+	expected := []string{"c.example.com", "d.example.com", "a.example.com", "b.example.com"}
+	for i := range expected {
+		if i >= len(order) || order[i] != expected[i] {
+			t.Fatalf("expected order %v, got: %v", expected, order)
+		}
+	}
+	filtered := results.filter("high")
+	if len(filtered.Vulnerabilities) != 4 || len(filtered.DNS) != 0 {
+		t.Errorf("expected only high and critical issues, got: %+v", filtered)
+	}
+	if len(results.DNS) != 1 {
+		t.Error("filtering should not modify the original results")
+	}
+}
+
+func TestIssueRate(t *testing.T) {
+	issue := Issue{Kind: "dangling"}
+	issue.rate()
+	if issue.Severity != "medium" || issue.Confidence != "likely" {
+		t.Errorf("unexpected default rating: %+v", issue)
+	}
+	issue = Issue{Kind: "vuln", Severity: "critical", Confidence: "confirmed"}
+	issue.rate()
+	if issue.Severity != "critical" || issue.Confidence != "confirmed" {
+		t.Errorf("rating should not be overridden: %+v", issue)
+	}
+}
@@ -0,0 +1,110 @@
+package subtocheck
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Suppression hides issues for an FQDN that have been accepted, until it expires
+type Suppression struct {
+	FQDN     string `yaml:"fqdn"`
+	Kind     string `yaml:"kind"`     // optional kind of issue
+	Platform string `yaml:"platform"` // optional platform of the issue
+	Reason   string `yaml:"reason"`
+	Expires  string `yaml:"expires"` // optional date, as YYYY-MM-DD, after which the suppression no longer applies
+	expires  time.Time
+}
+
+// matches returns true if the suppression applies to the issue at time now
+func (suppression Suppression) matches(issue Issue, now time.Time) bool {
+	if !suppression.expires.IsZero() && !now.Before(suppression.expires) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSuffix(suppression.FQDN, "."), strings.TrimSuffix(issue.FQDN, ".")) &&
+		(suppression.Kind == "" || suppression.Kind == issue.Kind) &&
+		(suppression.Platform == "" || strings.EqualFold(suppression.Platform, issue.Platform))
+}
+
+// suppressionReason returns the reason of the first suppression matching the issue, or an empty string if none do
+func suppressionReason(suppressions []Suppression, issue Issue, now time.Time) string {
+	for _, suppression := range suppressions {
+		if suppression.matches(issue, now) {
+			return suppression.Reason
+		}
+	}
+	return ""
+}
+
+// LoadSuppressions returns the suppressions defined in the YAML file at path
+func LoadSuppressions(path string) (suppressions []Suppression, err error) {
+	var content []byte
+	content, err = ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if suppressions, err = parseSuppressions(content); err != nil {
+		err = errors.Wrapf(err, "failed to load suppressions: \"%s\"", path)
+	}
+	return
+}
+
+func parseSuppressions(content []byte) (suppressions []Suppression, err error) {
+	if err = yaml.UnmarshalStrict(content, &suppressions); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i := range suppressions {
+		if err = validateSuppression(&suppressions[i]); err != nil {
+			return nil, errors.Wrapf(err, "suppression %d", i+1)
+		}
+	}
+	return
+}
+
+func validateSuppression(suppression *Suppression) (err error) {
+	if suppression.FQDN == "" {
+		return errors.New("fqdn not specified")
+	}
+	if suppression.Kind == "" && suppression.Platform == "" {
+		return errors.Errorf("%s: kind or platform must be specified", suppression.FQDN)
+	}
+	if _, ok := defaultRatings[suppression.Kind]; suppression.Kind != "" && !ok {
+		return errors.Errorf("%s: invalid kind '%s'", suppression.FQDN, suppression.Kind)
+	}
+	if suppression.Reason == "" {
+		return errors.Errorf("%s: reason not specified", suppression.FQDN)
+	}
+	if suppression.Expires != "" {
+		// suppressions last until the end of the day they expire
+		var expires time.Time
+		if expires, err = time.Parse("2006-01-02", suppression.Expires); err != nil {
+			return errors.Wrapf(err, "%s: invalid expires", suppression.FQDN)
+		}
+		suppression.expires = expires.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// suppress moves issues matching any of the suppressions at time now into the suppressed group, recording the
+// reason on each
+func (results Results) suppress(suppressions []Suppression, now time.Time) Results {
+	var suppressed []Issue
+	results = results.each(func(issues []Issue) (remaining []Issue) {
+		for _, issue := range issues {
+			if reason := suppressionReason(suppressions, issue, now); reason != "" {
+				issue.SuppressionReason = reason
+				suppressed = append(suppressed, issue)
+			} else {
+				remaining = append(remaining, issue)
+			}
+		}
+		return
+	})
+	results.Suppressed = append(results.Suppressed, suppressed...)
+	sortIssues(results.Suppressed)
+	return results
+}
@@ -0,0 +1,52 @@
+package subtocheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuppress(t *testing.T) {
+	suppressions, err := parseSuppressions([]byte(`
+- fqdn: parked.example.com
+  kind: dangling
+  reason: parked domain, accepted risk
+- fqdn: shop.example.com
+  platform: heroku
+  reason: migration in progress
+  expires: 2018-06-30
+`))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	results := getIssuesSummary(issues{
+		{Kind: "dangling", FQDN: "Parked.example.com."},
+		{Kind: "dns", FQDN: "parked.example.com"},
+		{Kind: "vuln", FQDN: "shop.example.com", Platform: "Heroku"},
+	})
+	suppressed := results.suppress(suppressions, time.Date(2018, 6, 30, 23, 0, 0, 0, time.UTC))
+	if len(suppressed.Suppressed) != 2 || len(suppressed.DNS) != 1 || len(suppressed.DanglingCNAMEs) != 0 ||
+		len(suppressed.Vulnerabilities) != 0 {
+		t.Errorf("unexpected results: %+v", suppressed)
+	}
+	for _, issue := range suppressed.Suppressed {
+		if issue.SuppressionReason == "" {
+			t.Errorf("expected suppression reason: %+v", issue)
+		}
+	}
+	expired := results.suppress(suppressions, time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC))
+	if len(expired.Vulnerabilities) != 1 || len(expired.Suppressed) != 1 {
+		t.Errorf("expected expired suppression not to apply: %+v", expired)
+	}
+
+	for _, content := range []string{
+		"- fqdn: a.example.com\n  reason: x\n",
+		"- fqdn: a.example.com\n  kind: dangling\n",
+		"- kind: dangling\n  reason: x\n",
+		"- fqdn: a.example.com\n  kind: takeover\n  reason: x\n",
+		"- fqdn: a.example.com\n  kind: dangling\n  reason: x\n  expires: 30/06/2018\n",
+	} {
+		if _, err = parseSuppressions([]byte(content)); err == nil {
+			t.Errorf("expected error parsing:\n%s", content)
+		}
+	}
+}